@@ -2,6 +2,8 @@ package bencode
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 )
 
 // Marshaler is the interface implemented by types that
@@ -36,14 +38,64 @@ type Unmarshaler interface {
 
 // Unmarshal parses the bencoded data and stores the result
 // in the value pointed to by v.
+//
+// Data must contain exactly one value, trailing data is reported
+// as a SyntaxError wrapping ErrTrailingData. Use a Decoder and its
+// InputOffset method to decode a value followed by other data.
 func Unmarshal(data []byte, v any) error {
 	d := NewDecodeBytes(data)
 	if err := d.Decode(v); err != nil {
 		return err
 	}
+	if d.cursor < d.length {
+		err := &SyntaxError{Offset: d.InputOffset(), Msg: "trailing data after top-level value", err: ErrTrailingData}
+		return fmt.Errorf("bencode: decode failed: %w", err)
+	}
+	return nil
+}
+
+// RawMessage is a raw encoded Bencode value.
+// It implements Marshaler and Unmarshaler and can be used
+// to delay Bencode decoding or precompute a Bencode encoding.
+//
+// When RawMessage is decoded by a Decoder it points into the input
+// without copying, so the exact bytes of a value (like a torrent info dictionary)
+// can be hashed while decoding the rest of the document.
+type RawMessage []byte
+
+// MarshalBencode returns m as the Bencode encoding of m.
+func (m RawMessage) MarshalBencode() ([]byte, error) {
+	if len(m) == 0 {
+		return nil, errors.New("bencode: cannot marshal empty RawMessage")
+	}
+	return m, nil
+}
+
+// UnmarshalBencode sets *m to a copy of data.
+func (m *RawMessage) UnmarshalBencode(data []byte) error {
+	if m == nil {
+		return errors.New("bencode: UnmarshalBencode on nil pointer")
+	}
+	*m = append((*m)[0:0], data...)
 	return nil
 }
 
+// FloatPolicy defines how floating point numbers are encoded and decoded.
+// Bencode has no floating point type, so there is no standard way to represent them.
+type FloatPolicy int
+
+const (
+	// FloatBits represents a float as an integer with IEEE 754 bits of the value.
+	// This is the default policy.
+	FloatBits FloatPolicy = iota
+
+	// FloatString represents a float as a decimal string, like 4:3.14.
+	FloatString
+
+	// FloatError rejects floats with an error.
+	FloatError
+)
+
 // A is a Bencode array.
 //
 // Example:
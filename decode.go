@@ -2,25 +2,50 @@ package bencode
 
 import (
 	"bytes"
+	"encoding"
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
+	"math"
+	"math/big"
+	"reflect"
 	"strconv"
+	"strings"
 )
 
 // A Decoder reads and decodes Bencode values from an input stream.
 type Decoder struct {
-	r          io.Reader
-	fromReader bool
-	data       []byte
-	length     int
-	cursor     int
+	r      io.Reader
+	rerr   error // error returned by r, if any
+	data   []byte
+	length int
+	cursor int
+	offset int64 // input offset of data[0]
+	start  int   // start of the current top-level value in data
+	tokens []tokenLevel
+
+	canonical   bool
+	useBigInt   bool
+	useUint64   bool
+	ordered     bool
+	useStrings  bool
+	copyBytes   bool
+	unsafeKeys  bool
+	keys        map[string]string // interned dictionary keys
+	floatPolicy FloatPolicy
+	limits      Limits
+	depth       int
 }
 
+// minRead is the minimal size of a read from the underlying reader.
+const minRead = 512
+
 // NewDecoder returns a new decoder that reads from r.
+//
+// The decoder introduces its own buffering and may read
+// data from r beyond the Bencode values requested.
 func NewDecoder(r io.Reader) *Decoder {
-	return &Decoder{r: r, fromReader: true}
+	return &Decoder{r: r}
 }
 
 // NewDecodeBytes returns a new decoder that decodes given bytes.
@@ -32,7 +57,112 @@ func NewDecodeBytes(src []byte) *Decoder {
 	return d
 }
 
-// Decode writes the Bencode encoding of v to the stream.
+// DisallowNonCanonical causes the Decoder to return an error
+// when the input is not in the canonical form: integers or string lengths
+// with leading zeros or a sign, negative zero, unsorted or duplicate dictionary keys.
+//
+// Only canonical input gives the same bytes when encoded back,
+// which matters for hashes like a torrent info-hash.
+func (d *Decoder) DisallowNonCanonical() {
+	d.canonical = true
+}
+
+// UseBigInt causes the Decoder to decode integers which do not fit into int64
+// as *big.Int instead of returning an error, when decoding into an interface value.
+func (d *Decoder) UseBigInt() {
+	d.useBigInt = true
+}
+
+// UseUint64 causes the Decoder to decode integers which do not fit into int64
+// but fit into uint64 as uint64 instead of returning an error,
+// when decoding into an interface value.
+// It takes precedence over UseBigInt.
+func (d *Decoder) UseUint64() {
+	d.useUint64 = true
+}
+
+// UseOrdered causes the Decoder to decode dictionaries as D and lists as A
+// instead of map[string]any and []any, when decoding into an interface value.
+// D keeps the original order of keys, including duplicates,
+// so the value is encoded back into the same bytes.
+//
+// Values of type D and A are always decoded in this way.
+func (d *Decoder) UseOrdered() {
+	d.ordered = true
+}
+
+// UseStrings causes the Decoder to decode strings as string instead of []byte,
+// when decoding into an interface value.
+func (d *Decoder) UseStrings() {
+	d.useStrings = true
+}
+
+// CopyBytes causes the Decoder to copy decoded []byte values and RawMessage.
+// By default they point into the input buffer and
+// must not be used after the buffer is modified or reused.
+func (d *Decoder) CopyBytes() {
+	d.copyBytes = true
+}
+
+// UseUnsafeKeys causes the Decoder to not copy dictionary keys
+// when decoding into maps and D, keys point into the input buffer instead.
+// This saves allocations, but the caller must not modify the input
+// while the decoded keys are in use.
+func (d *Decoder) UseUnsafeKeys() {
+	d.unsafeKeys = true
+}
+
+// SetFloatPolicy sets how floating point numbers are decoded,
+// it should match the policy used by the encoder. Default is FloatBits.
+func (d *Decoder) SetFloatPolicy(p FloatPolicy) {
+	d.floatPolicy = p
+}
+
+// DefaultMaxDepth is the maximum nesting depth of lists
+// and dictionaries used when Limits.MaxDepth is not set.
+const DefaultMaxDepth = 10000
+
+// Limits restricts resources used by a Decoder on untrusted input.
+// Zero value of a field means no limit, except for MaxDepth.
+type Limits struct {
+	// MaxDepth is the maximum nesting depth of lists and dictionaries.
+	// DefaultMaxDepth is used when it is zero.
+	MaxDepth int
+
+	// MaxInputSize is the maximum number of bytes consumed by the decoder.
+	MaxInputSize int64
+
+	// MaxStringLength is the maximum length of a string.
+	MaxStringLength int64
+
+	// MaxElements is the maximum number of elements in a single list or dictionary.
+	MaxElements int
+}
+
+// SetLimits sets limits for the decoded input.
+// On violation the Decoder returns LimitExceededError.
+func (d *Decoder) SetLimits(limits Limits) {
+	d.limits = limits
+}
+
+// Buffered returns a reader of the data remaining in the Decoder's buffer.
+// The reader is valid until the next call to Decode.
+func (d *Decoder) Buffered() io.Reader {
+	return bytes.NewReader(d.data[d.cursor:d.length])
+}
+
+// InputOffset returns the input stream byte offset of the current decoder position.
+// The offset gives the location of the end of the most recently returned value
+// and the beginning of the next one.
+func (d *Decoder) InputOffset() int64 {
+	return d.offset + int64(d.cursor)
+}
+
+// Decode reads the next Bencode-encoded value from its input
+// and stores it in the value pointed to by v.
+//
+// Decode can be called repeatedly to decode concatenated values,
+// io.EOF is returned when the input is exhausted.
 func (d *Decoder) Decode(v any) error {
 	switch v.(type) {
 	case nil:
@@ -42,114 +172,750 @@ func (d *Decoder) Decode(v any) error {
 		// so decoding below even if `v` isn't a supported type.
 	}
 
-	if d.fromReader {
-		var err error
-		d.data, err = ioutil.ReadAll(d.r)
-		if err != nil {
-			return fmt.Errorf("bencode: cannot read from reader: %w", err)
-		}
-		d.length = len(d.data)
-	}
-	if d.length == 0 {
+	if d.r == nil && d.length == 0 {
 		return errors.New("bencode: cannot decode empty input")
 	}
+	if err := d.checkInputSize(); err != nil {
+		return err
+	}
 
-	got, err := d.unmarshal()
+	d.start = d.cursor
+	d.depth = len(d.tokens)
+	c, err := d.peek()
 	if err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return io.EOF
+		}
+		return fmt.Errorf("bencode: cannot read from reader: %w", err)
+	}
+
+	rv := reflect.ValueOf(v)
+	switch {
+	case rv.Kind() != reflect.Ptr:
+		return fmt.Errorf("bencode: cannot decode into non-pointer %T", v)
+	case rv.IsNil():
+		return fmt.Errorf("bencode: cannot decode into nil %T", v)
+	}
+
+	fast := false
+	switch v.(type) {
+	case *any:
+		fast = true
+	case *map[string]any, *[]any:
+		// in ordered mode only nested values are D and A, this is done by reflection
+		fast = !d.ordered
+	}
+
+	if fast {
+		if err := checkKind(v, c); err != nil {
+			err.Offset = d.InputOffset()
+			return fmt.Errorf("bencode: decode failed: %w", err)
+		}
+		got, err := d.unmarshal()
+		if err != nil {
+			return fmt.Errorf("bencode: decode failed: %w", err)
+		}
+		d.tokenDone()
+		writeResult(v, got)
+		return nil
+	}
+
+	if err := d.decodeValue(rv.Elem()); err != nil {
 		return fmt.Errorf("bencode: decode failed: %w", err)
 	}
-	return d.writeResult(v, got)
+	d.tokenDone()
+	return nil
 }
 
-func (d *Decoder) writeResult(v, got any) error {
+// checkKind reports an error when the value starting with c cannot be stored in v.
+func checkKind(v any, c byte) *UnmarshalTypeError {
+	switch v.(type) {
+	case *map[string]any:
+		if c != 'd' {
+			return &UnmarshalTypeError{Value: kindOf(c), Type: reflect.TypeOf(v).Elem()}
+		}
+	case *[]any:
+		if c != 'l' {
+			return &UnmarshalTypeError{Value: kindOf(c), Type: reflect.TypeOf(v).Elem()}
+		}
+	}
+	return nil
+}
+
+// writeResult stores got into v, kinds are checked by checkKind.
+func writeResult(v, got any) {
 	switch v := v.(type) {
 	case *any: // catch any type
 		*v = got
-
 	case *map[string]any:
-		val, ok := got.(map[string]any)
-		if !ok {
-			return fmt.Errorf("bencode: cannot decode %T into map", got)
+		*v = got.(map[string]any)
+	case *[]any:
+		*v = got.([]any)
+	}
+}
+
+// decodeValue decodes next value into v using reflection.
+func (d *Decoder) decodeValue(v reflect.Value) error {
+	c, err := d.peek()
+	if err != nil {
+		return err
+	}
+
+	// buffer can be reallocated while reading, so keep an input offset
+	start := d.InputOffset()
+
+	u, v := indirect(v)
+	if u != nil || v.Type() == rawMessageType {
+		if err := d.skip(); err != nil {
+			return err
+		}
+		raw := d.data[int(start-d.offset):d.cursor:d.cursor]
+		if u != nil {
+			return u.UnmarshalBencode(raw)
 		}
-		*v = val
+		v.SetBytes(d.bytesValue(raw)) // RawMessage points into the input unless copied
+		return nil
+	}
 
-	case *[]any:
-		val, ok := got.([]any)
-		if !ok {
-			return fmt.Errorf("bencode: cannot decode %T into list", got)
+	switch c {
+	case 'i':
+		digits, err := d.readInt()
+		if err != nil {
+			return err
+		}
+		if err := d.setInt(v, digits); err != nil {
+			err.Offset = start
+			return err
+		}
+		return nil
+
+	case 'd':
+		switch {
+		case v.Type() == dType:
+			return d.decodeOrdered(v)
+		case v.Kind() == reflect.Struct && v.Type() != bigIntType:
+			return d.decodeStruct(v)
+		case v.Kind() == reflect.Map:
+			return d.decodeMap(v)
+		}
+
+	case 'l':
+		switch {
+		case v.Type() == aType:
+			return d.decodeOrdered(v)
+		case v.Kind() == reflect.Slice && v.Type() != dType && v.Type().Elem().Kind() != reflect.Uint8:
+			return d.decodeList(v)
+		case v.Kind() == reflect.Array && v.Type().Elem().Kind() != reflect.Uint8:
+			return d.decodeArray(v)
 		}
-		*v = val
 
 	default:
-		// TODO: decode into struct if got map
+		b, err := d.unmarshalString()
+		if err != nil {
+			return err
+		}
+		if err := d.setString(v, b); err != nil {
+			err.Offset = start
+			return err
+		}
+		return nil
+	}
+
+	if v.Kind() == reflect.Interface && v.NumMethod() == 0 {
+		got, err := d.unmarshal()
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(got))
+		return nil
+	}
+	return &UnmarshalTypeError{Value: kindOf(c), Type: v.Type(), Offset: start}
+}
+
+// decodeOrdered decodes next value into D or A, nested values are D and A too.
+func (d *Decoder) decodeOrdered(v reflect.Value) error {
+	ordered := d.ordered
+	d.ordered = true
+	got, err := d.unmarshal()
+	d.ordered = ordered
+	if err != nil {
+		return err
 	}
+	v.Set(reflect.ValueOf(got))
 	return nil
 }
 
+func (d *Decoder) decodeStruct(v reflect.Value) error {
+	fields := cachedFields(v.Type())
+	var prev []byte
+	if err := d.enter(); err != nil {
+		return err
+	}
+	for n := 0; ; n++ {
+		end, err := d.atEnd("dictionary", n)
+		if err != nil {
+			return err
+		}
+		if end {
+			return nil
+		}
+
+		key, err := d.unmarshalKey(prev)
+		if err != nil {
+			return err
+		}
+		prev = key
+
+		var field reflect.Value
+		if idx, ok := fields.byName[string(key)]; ok {
+			field, _ = fieldByIndexAlloc(v, fields.list[idx].index)
+		}
+		if !field.IsValid() {
+			// unknown key or unexported embedded pointer, skip its value
+			if err := d.skip(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := d.decodeValue(field); err != nil {
+			return withKey(err, key)
+		}
+	}
+}
+
+func (d *Decoder) decodeMap(v reflect.Value) error {
+	t := v.Type()
+	if !isMapKeyType(t.Key()) {
+		return &UnmarshalTypeError{Value: "dictionary", Type: t, Offset: d.InputOffset()}
+	}
+	if v.IsNil() {
+		v.Set(reflect.MakeMap(t))
+	}
+
+	zero := reflect.Zero(t.Elem())
+	elem := reflect.New(t.Elem()).Elem()
+	var prev []byte
+	if err := d.enter(); err != nil {
+		return err
+	}
+	for n := 0; ; n++ {
+		end, err := d.atEnd("dictionary", n)
+		if err != nil {
+			return err
+		}
+		if end {
+			return nil
+		}
+
+		start := d.InputOffset()
+		key, err := d.unmarshalKey(prev)
+		if err != nil {
+			return err
+		}
+		prev = key
+
+		kv, err := d.mapKeyValue(t.Key(), key)
+		if err != nil {
+			if err, ok := err.(*UnmarshalTypeError); ok {
+				err.Offset = start
+			}
+			return withKey(err, key)
+		}
+
+		elem.Set(zero)
+		if err := d.decodeValue(elem); err != nil {
+			return withKey(err, key)
+		}
+		v.SetMapIndex(kv, elem)
+	}
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// isMapKeyType reports whether a map with keys of type t can be decoded.
+func isMapKeyType(t reflect.Type) bool {
+	switch {
+	case t.Kind() == reflect.String:
+		return true
+	case reflect.PtrTo(t).Implements(textUnmarshalerType):
+		return true
+	case t.Kind() == reflect.Array && t.Elem().Kind() == reflect.Uint8:
+		return true
+	default:
+		return false
+	}
+}
+
+// mapKeyValue converts a dictionary key into a map key of type t,
+// this mirrors the mapKey function of the encoder.
+func (d *Decoder) mapKeyValue(t reflect.Type, key []byte) (reflect.Value, error) {
+	switch {
+	case t.Kind() == reflect.String:
+		return reflect.ValueOf(d.keyString(key)).Convert(t), nil
+
+	case reflect.PtrTo(t).Implements(textUnmarshalerType):
+		kv := reflect.New(t)
+		if err := kv.Interface().(encoding.TextUnmarshaler).UnmarshalText(key); err != nil {
+			return reflect.Value{}, err
+		}
+		return kv.Elem(), nil
+
+	default:
+		kv := reflect.New(t).Elem()
+		if kv.Len() != len(key) {
+			return reflect.Value{}, &UnmarshalTypeError{Value: "dictionary key of length " + strconv.Itoa(len(key)), Type: t}
+		}
+		for i := 0; i < len(key); i++ {
+			kv.Index(i).SetUint(uint64(key[i]))
+		}
+		return kv, nil
+	}
+}
+
+func (d *Decoder) decodeList(v reflect.Value) error {
+	zero := reflect.Zero(v.Type().Elem())
+	if v.IsNil() {
+		v.Set(reflect.MakeSlice(v.Type(), 0, 0))
+	}
+
+	if err := d.enter(); err != nil {
+		return err
+	}
+	for i := 0; ; i++ {
+		end, err := d.atEnd("list", i)
+		if err != nil {
+			return err
+		}
+		if end {
+			v.SetLen(i)
+			return nil
+		}
+
+		if i < v.Cap() {
+			v.SetLen(i + 1)
+			v.Index(i).Set(zero)
+		} else {
+			v.Set(reflect.Append(v, zero))
+		}
+		if err := d.decodeValue(v.Index(i)); err != nil {
+			return withIndex(err, i)
+		}
+	}
+}
+
+func (d *Decoder) decodeArray(v reflect.Value) error {
+	start := d.InputOffset()
+	if err := d.enter(); err != nil {
+		return err
+	}
+	for i := 0; ; i++ {
+		end, err := d.atEnd("list", i)
+		if err != nil {
+			return err
+		}
+		if end {
+			if i != v.Len() {
+				return &UnmarshalTypeError{Value: "list of length " + strconv.Itoa(i), Type: v.Type(), Offset: start}
+			}
+			return nil
+		}
+		if i == v.Len() {
+			return &UnmarshalTypeError{Value: "list longer than " + strconv.Itoa(i), Type: v.Type(), Offset: start}
+		}
+
+		if err := d.decodeValue(v.Index(i)); err != nil {
+			return withIndex(err, i)
+		}
+	}
+}
+
+var (
+	rawMessageType = reflect.TypeOf(RawMessage(nil))
+	bigIntType     = reflect.TypeOf(big.Int{})
+	int64Type      = reflect.TypeOf(int64(0))
+	dType          = reflect.TypeOf(D(nil))
+	aType          = reflect.TypeOf(A(nil))
+)
+
+// indirect walks down v allocating pointers as needed
+// until it gets to a non-pointer, a RawMessage or an Unmarshaler.
+func indirect(v reflect.Value) (Unmarshaler, reflect.Value) {
+	// start from the pointer, so methods with a pointer receiver are found
+	if v.Kind() != reflect.Ptr && v.CanAddr() {
+		v = v.Addr()
+	}
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		if v.Type().Elem() == rawMessageType {
+			return nil, v.Elem()
+		}
+		if v.Type().NumMethod() > 0 && v.CanInterface() {
+			if u, ok := v.Interface().(Unmarshaler); ok {
+				return u, reflect.Value{}
+			}
+		}
+		v = v.Elem()
+	}
+	return nil, v
+}
+
+// setInt stores decoded integer into v.
+func (d *Decoder) setInt(v reflect.Value, digits []byte) *UnmarshalTypeError {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(b2s(digits), 10, v.Type().Bits())
+		if err == nil {
+			v.SetInt(n)
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := parseUint(digits, v.Type().Bits())
+		if err == nil {
+			v.SetUint(n)
+			return nil
+		}
+	case reflect.Bool:
+		n, err := strconv.ParseInt(b2s(digits), 10, 64)
+		if err == nil && (n == 0 || n == 1) {
+			v.SetBool(n == 1)
+			return nil
+		}
+	case reflect.Float32:
+		n, err := strconv.ParseUint(b2s(digits), 10, 32)
+		if err == nil && d.floatPolicy == FloatBits {
+			v.SetFloat(float64(math.Float32frombits(uint32(n))))
+			return nil
+		}
+	case reflect.Float64:
+		n, err := strconv.ParseInt(b2s(digits), 10, 64)
+		if err == nil && d.floatPolicy == FloatBits {
+			v.SetFloat(math.Float64frombits(uint64(n)))
+			return nil
+		}
+	case reflect.Struct:
+		if v.Type() == bigIntType {
+			v.Addr().Interface().(*big.Int).SetString(string(digits), 10)
+			return nil
+		}
+	case reflect.Interface:
+		if v.NumMethod() == 0 {
+			if n, ok := d.intValue(digits); ok {
+				v.Set(reflect.ValueOf(n))
+				return nil
+			}
+		}
+	}
+	return &UnmarshalTypeError{Value: "integer " + string(digits), Type: v.Type()}
+}
+
+// setString stores decoded string into v.
+func (d *Decoder) setString(v reflect.Value, b []byte) *UnmarshalTypeError {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(string(b))
+		return nil
+
+	case reflect.Float32, reflect.Float64:
+		if d.floatPolicy != FloatString {
+			break
+		}
+		f, err := strconv.ParseFloat(b2s(b), v.Type().Bits())
+		if err == nil {
+			v.SetFloat(f)
+			return nil
+		}
+		return &UnmarshalTypeError{Value: "string " + strconv.Quote(string(b)), Type: v.Type()}
+
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes(d.bytesValue(b))
+			return nil
+		}
+
+	case reflect.Array:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			break
+		}
+		if v.Len() != len(b) {
+			return &UnmarshalTypeError{Value: "string of length " + strconv.Itoa(len(b)), Type: v.Type()}
+		}
+		for i := 0; i < len(b); i++ {
+			v.Index(i).SetUint(uint64(b[i]))
+		}
+		return nil
+
+	case reflect.Interface:
+		if v.NumMethod() == 0 {
+			v.Set(reflect.ValueOf(d.stringValue(b)))
+			return nil
+		}
+	}
+	return &UnmarshalTypeError{Value: "string", Type: v.Type()}
+}
+
+// stringValue returns decoded string b as an interface value.
+func (d *Decoder) stringValue(b []byte) any {
+	if d.useStrings {
+		return string(b)
+	}
+	return d.bytesValue(b)
+}
+
+// bytesValue returns b or its copy when CopyBytes is set.
+func (d *Decoder) bytesValue(b []byte) []byte {
+	if d.copyBytes {
+		return append(make([]byte, 0, len(b)), b...)
+	}
+	return b
+}
+
+// kindOf returns a name of the Bencode type starting with the given byte.
+func kindOf(c byte) string {
+	switch c {
+	case 'i':
+		return "integer"
+	case 'l':
+		return "list"
+	case 'd':
+		return "dictionary"
+	default:
+		return "string"
+	}
+}
+
 func (d *Decoder) unmarshal() (any, error) {
-	switch d.data[d.cursor] {
+	c, err := d.peek()
+	if err != nil {
+		return nil, err
+	}
+
+	switch c {
 	case 'i':
-		return d.unmarshalInt()
+		start := d.InputOffset()
+		digits, err := d.readInt()
+		if err != nil {
+			return nil, err
+		}
+		n, ok := d.intValue(digits)
+		if !ok {
+			return nil, &UnmarshalTypeError{Value: "integer " + string(digits), Type: int64Type, Offset: start}
+		}
+		return n, nil
 	case 'd':
+		if d.ordered {
+			return d.unmarshalDict()
+		}
 		return d.unmarshalMap()
 	case 'l':
 		return d.unmarshalList()
 	default:
-		return d.unmarshalString()
+		b, err := d.unmarshalString()
+		if err != nil {
+			return nil, err
+		}
+		return d.stringValue(b), nil
 	}
 }
 
-func (d *Decoder) unmarshalInt() (int64, error) {
-	d.cursor++
-	index := bytes.IndexByte(d.data[d.cursor:], 'e')
-	if index == -1 {
-		return 0, errors.New("cannot process invalid integer")
+// skip skips next value without allocations.
+func (d *Decoder) skip() error {
+	c, err := d.peek()
+	if err != nil {
+		return err
+	}
+
+	switch c {
+	case 'i':
+		_, err := d.readInt()
+		return err
+	case 'd':
+		var prev []byte
+		if err := d.enter(); err != nil {
+			return err
+		}
+		for n := 0; ; n++ {
+			end, err := d.atEnd("dictionary", n)
+			if err != nil {
+				return err
+			}
+			if end {
+				return nil
+			}
+			if prev, err = d.unmarshalKey(prev); err != nil {
+				return err
+			}
+			if err := d.skip(); err != nil {
+				return err
+			}
+		}
+	case 'l':
+		if err := d.enter(); err != nil {
+			return err
+		}
+		for n := 0; ; n++ {
+			end, err := d.atEnd("list", n)
+			if err != nil {
+				return err
+			}
+			if end {
+				return nil
+			}
+			if err := d.skip(); err != nil {
+				return err
+			}
+		}
+	default:
+		_, err := d.unmarshalString()
+		return err
 	}
+}
 
-	index += d.cursor
-	integer, err := strconv.ParseInt(b2s(d.data[d.cursor:index]), 10, 64)
+// readInt reads an integer of any size and returns its digits.
+func (d *Decoder) readInt() ([]byte, error) {
+	start := d.InputOffset()
+	d.cursor++
+	n, err := d.scanNumber('e')
 	if err != nil {
-		return 0, err
+		return nil, d.numberError(err, start, ErrInvalidInteger, "invalid integer")
+	}
+
+	digits := d.data[d.cursor : d.cursor+n]
+	if d.canonical {
+		if msg := checkCanonicalInt(digits); msg != "" {
+			return nil, &SyntaxError{Offset: start, Msg: msg, err: ErrNonCanonical}
+		}
+	}
+	if !isInteger(digits) {
+		return nil, &SyntaxError{Offset: start, Msg: "invalid integer " + strconv.Quote(string(digits)), err: ErrInvalidInteger}
 	}
-	d.cursor = index + 1
-	return integer, nil
+	d.cursor += n + 1
+	return digits, nil
+}
+
+// intValue converts integer digits into a value for an interface.
+func (d *Decoder) intValue(digits []byte) (any, bool) {
+	n, err := strconv.ParseInt(b2s(digits), 10, 64)
+	if err == nil {
+		return n, true
+	}
+	if d.useUint64 {
+		if n, err := parseUint(digits, 64); err == nil {
+			return n, true
+		}
+	}
+	if d.useBigInt {
+		return new(big.Int).SetString(string(digits), 10)
+	}
+	return nil, false
+}
+
+// parseUint parses unsigned integer digits, the sign is allowed as in strconv.ParseInt.
+func parseUint(digits []byte, bitSize int) (uint64, error) {
+	switch {
+	case len(digits) > 0 && digits[0] == '+':
+		digits = digits[1:]
+	case len(digits) > 0 && digits[0] == '-':
+		if strings.Trim(b2s(digits[1:]), "0") != "" {
+			return 0, strconv.ErrRange
+		}
+		return 0, nil
+	}
+	return strconv.ParseUint(b2s(digits), 10, bitSize)
+}
+
+// isInteger reports whether digits is an optionally signed decimal number.
+func isInteger(digits []byte) bool {
+	if len(digits) > 0 && (digits[0] == '-' || digits[0] == '+') {
+		digits = digits[1:]
+	}
+	if len(digits) == 0 {
+		return false
+	}
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
 }
 
 func (d *Decoder) unmarshalMap() (any, error) {
 	dictionary := make(map[string]any)
-	d.cursor++
-	for {
-		if d.cursor == d.length {
-			return nil, errors.New("cannot process invalid dictionary")
+	var prev []byte
+	if err := d.enter(); err != nil {
+		return nil, err
+	}
+	for n := 0; ; n++ {
+		end, err := d.atEnd("dictionary", n)
+		if err != nil {
+			return nil, err
 		}
-		if d.data[d.cursor] == 'e' {
-			d.cursor++
+		if end {
 			return dictionary, nil
 		}
 
 		// try to decode a dict key. it's a string by the Bencode specification
-		key, err := d.unmarshalString()
+		key, err := d.unmarshalKey(prev)
+		if err != nil {
+			return nil, err
+		}
+		prev = key
+
+		value, err := d.unmarshal()
+		if err != nil {
+			return nil, err
+		}
+		dictionary[d.keyString(key)] = value
+	}
+}
+
+// unmarshalDict is like unmarshalMap but keeps the order of keys.
+func (d *Decoder) unmarshalDict() (any, error) {
+	dict := make(D, 0)
+	var prev []byte
+	if err := d.enter(); err != nil {
+		return nil, err
+	}
+	for n := 0; ; n++ {
+		end, err := d.atEnd("dictionary", n)
+		if err != nil {
+			return nil, err
+		}
+		if end {
+			return dict, nil
+		}
+
+		key, err := d.unmarshalKey(prev)
 		if err != nil {
 			return nil, err
 		}
+		prev = key
 
 		value, err := d.unmarshal()
 		if err != nil {
 			return nil, err
 		}
-		dictionary[b2s(key)] = value
+		dict = append(dict, e{K: d.keyString(key), V: value})
 	}
 }
 
 func (d *Decoder) unmarshalList() (any, error) {
 	list := make([]any, 0)
-	d.cursor++
-	for {
-		if d.cursor == d.length {
-			return nil, errors.New("cannot process invalid list")
+	if err := d.enter(); err != nil {
+		return nil, err
+	}
+	for n := 0; ; n++ {
+		end, err := d.atEnd("list", n)
+		if err != nil {
+			return nil, err
 		}
-		if d.data[d.cursor] == 'e' {
-			d.cursor++
+		if end {
+			if d.ordered {
+				return A(list), nil
+			}
 			return list, nil
 		}
 		value, err := d.unmarshal()
@@ -160,28 +926,310 @@ func (d *Decoder) unmarshalList() (any, error) {
 	}
 }
 
-func (d *Decoder) unmarshalString() ([]byte, error) {
-	index := bytes.IndexByte(d.data[d.cursor:], ':')
-	if index == -1 {
-		return nil, errors.New("cannot process invalid string")
+const (
+	maxInternKeys   = 1024
+	maxInternKeyLen = 64
+)
+
+// keyString returns a dictionary key as a string, copying it unless UseUnsafeKeys is set.
+// Short keys are interned, so keys repeating across values are allocated once.
+func (d *Decoder) keyString(key []byte) string {
+	if d.unsafeKeys {
+		return b2s(key)
+	}
+	if len(key) > maxInternKeyLen {
+		return string(key)
+	}
+	if s, ok := d.keys[string(key)]; ok {
+		return s
+	}
+
+	s := string(key)
+	if len(d.keys) < maxInternKeys {
+		if d.keys == nil {
+			d.keys = make(map[string]string)
+		}
+		d.keys[s] = s
 	}
+	return s
+}
 
-	index += d.cursor
-	strLen, err := strconv.ParseInt(b2s(d.data[d.cursor:index]), 10, 64)
+// unmarshalKey decodes a dictionary key, which must be a string.
+// In canonical mode the key must be greater than the previous key prev.
+func (d *Decoder) unmarshalKey(prev []byte) ([]byte, error) {
+	c, err := d.peek()
 	if err != nil {
 		return nil, err
 	}
+
+	start := d.InputOffset()
+	if c < '0' || c > '9' {
+		return nil, &SyntaxError{
+			Offset: start,
+			Msg:    "dictionary key must be a string, got " + kindOf(c),
+			err:    ErrInvalidDict,
+		}
+	}
+
+	key, err := d.unmarshalString()
+	if err != nil {
+		return nil, err
+	}
+	if d.canonical && prev != nil {
+		switch bytes.Compare(prev, key) {
+		case 0:
+			return nil, &SyntaxError{Offset: start, Msg: "duplicate dictionary key " + strconv.Quote(string(key)), err: ErrNonCanonical}
+		case 1:
+			return nil, &SyntaxError{Offset: start, Msg: "dictionary key " + strconv.Quote(string(key)) + " is not sorted", err: ErrNonCanonical}
+		}
+	}
+	return key, nil
+}
+
+func (d *Decoder) unmarshalString() ([]byte, error) {
+	start := d.InputOffset()
+	n, err := d.scanNumber(':')
+	if err != nil {
+		return nil, d.numberError(err, start, ErrInvalidString, "invalid string length")
+	}
+
+	digits := d.data[d.cursor : d.cursor+n]
+	if d.canonical {
+		if msg := checkCanonicalLength(digits); msg != "" {
+			return nil, &SyntaxError{Offset: start, Msg: msg, err: ErrNonCanonical}
+		}
+	}
+
+	strLen, err := strconv.ParseInt(b2s(digits), 10, 64)
+	if err != nil {
+		return nil, &SyntaxError{Offset: start, Msg: "invalid string length " + strconv.Quote(string(digits)), err: ErrInvalidString}
+	}
 	if strLen < 0 {
-		return nil, errors.New("string length can not be a negative")
+		return nil, &SyntaxError{Offset: start, Msg: "string length can not be a negative", err: ErrInvalidString}
+	}
+
+	if limit := d.limits.MaxStringLength; limit > 0 && strLen > limit {
+		return nil, &LimitExceededError{Limit: "string length", Max: limit, Offset: start}
 	}
 
-	index++
-	endIndex := index + int(strLen)
-	if endIndex > d.length {
-		return nil, errors.New("string length is not correct")
+	d.cursor += n + 1
+	if err := d.ensure(strLen); err != nil {
+		return nil, d.eofError(err, "string of length "+strconv.FormatInt(strLen, 10))
 	}
 
-	value := d.data[index:endIndex]
-	d.cursor = endIndex
+	end := d.cursor + int(strLen)
+	value := d.data[d.cursor:end:end]
+	d.cursor = end
 	return value, nil
 }
+
+// checkCanonicalInt returns a description of a problem
+// if the integer digits are not in the canonical form.
+func checkCanonicalInt(digits []byte) string {
+	switch {
+	case len(digits) == 0:
+		return "empty integer"
+	case digits[0] == '+':
+		return "integer with a plus sign"
+	case digits[0] == '-' && len(digits) > 1 && digits[1] == '0':
+		if len(digits) == 2 {
+			return "negative zero"
+		}
+		return "integer with a leading zero"
+	case digits[0] == '0' && len(digits) > 1:
+		return "integer with a leading zero"
+	}
+	return ""
+}
+
+// checkCanonicalLength returns a description of a problem
+// if the string length digits are not in the canonical form.
+func checkCanonicalLength(digits []byte) string {
+	switch {
+	case len(digits) == 0:
+		return "empty string length"
+	case digits[0] == '+' || digits[0] == '-':
+		return "string length with a sign"
+	case digits[0] == '0' && len(digits) > 1:
+		return "string length with a leading zero"
+	}
+	return ""
+}
+
+// probeEOF is called when the input size limit is reached.
+// It reports the end of input if the reader has no more data
+// and LimitExceededError otherwise.
+func (d *Decoder) probeEOF() error {
+	var probe [1]byte
+	for {
+		n, err := d.r.Read(probe[:])
+		switch {
+		case n > 0:
+			return &LimitExceededError{Limit: "input size", Max: d.limits.MaxInputSize, Offset: d.offset + int64(d.length)}
+		case err != nil:
+			d.rerr = err
+			return d.refill()
+		}
+	}
+}
+
+// checkInputSize checks the size limit of an input given as bytes.
+func (d *Decoder) checkInputSize() error {
+	if limit := d.limits.MaxInputSize; d.r == nil && limit > 0 && int64(d.length) > limit {
+		return &LimitExceededError{Limit: "input size", Max: limit, Offset: limit}
+	}
+	return nil
+}
+
+// enter moves the cursor into a list or a dictionary.
+func (d *Decoder) enter() error {
+	d.depth++
+	if maxDepth := d.maxDepth(); d.depth > maxDepth {
+		return &LimitExceededError{Limit: "depth", Max: int64(maxDepth), Offset: d.InputOffset()}
+	}
+	d.cursor++
+	return nil
+}
+
+// atEnd reports whether the cursor is at the end of a list or a dictionary
+// with n elements read so far. The terminating 'e' is consumed.
+func (d *Decoder) atEnd(what string, n int) (bool, error) {
+	if d.cursor == d.length {
+		if err := d.refill(); err != nil {
+			return false, d.eofError(err, what)
+		}
+	}
+	if d.data[d.cursor] != 'e' {
+		if limit := d.limits.MaxElements; limit > 0 && n >= limit {
+			return false, &LimitExceededError{Limit: "elements", Max: int64(limit), Offset: d.InputOffset()}
+		}
+		return false, nil
+	}
+	d.cursor++
+	d.depth--
+	return true, nil
+}
+
+func (d *Decoder) maxDepth() int {
+	if d.limits.MaxDepth > 0 {
+		return d.limits.MaxDepth
+	}
+	return DefaultMaxDepth
+}
+
+// peek returns the byte at the cursor, reading more input if needed.
+func (d *Decoder) peek() (byte, error) {
+	if d.cursor == d.length {
+		if err := d.refill(); err != nil {
+			return 0, d.eofError(err, "value")
+		}
+	}
+	return d.data[d.cursor], nil
+}
+
+// ensure reads input until at least n bytes are available after the cursor.
+func (d *Decoder) ensure(n int64) error {
+	for int64(d.length-d.cursor) < n {
+		if err := d.refill(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// errNotNumber is returned by scanNumber on a non-numeric byte.
+var errNotNumber = errors.New("not a number")
+
+// scanNumber returns the length of a number at the cursor terminated by delim.
+func (d *Decoder) scanNumber(delim byte) (int, error) {
+	for i := 0; ; i++ {
+		if d.cursor+i == d.length {
+			if err := d.refill(); err != nil {
+				return 0, err
+			}
+		}
+
+		switch c := d.data[d.cursor+i]; {
+		case c == delim:
+			return i, nil
+		case c >= '0' && c <= '9', c == '-', c == '+':
+		default:
+			return 0, errNotNumber
+		}
+	}
+}
+
+// numberError converts scanNumber error into a syntax error.
+func (d *Decoder) numberError(err error, offset int64, sentinel error, msg string) error {
+	if err == errNotNumber {
+		return &SyntaxError{Offset: offset, Msg: msg, err: sentinel}
+	}
+	return d.eofError(err, msg)
+}
+
+// eofError converts the end of input into a syntax error, other errors are returned as is.
+func (d *Decoder) eofError(err error, what string) error {
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		return err
+	}
+	return &SyntaxError{
+		Offset: d.offset + int64(d.length),
+		Msg:    "unexpected end of input in " + what,
+		err:    io.ErrUnexpectedEOF,
+	}
+}
+
+// refill reads more input into the buffer.
+//
+// Bytes before the current top-level value are dropped when the buffer grows.
+// Buffer is never modified in place, so already decoded values
+// which point into it remain intact.
+func (d *Decoder) refill() error {
+	if d.r == nil {
+		return io.ErrUnexpectedEOF
+	}
+	if d.rerr != nil {
+		if d.rerr == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return d.rerr
+	}
+
+	if cap(d.data)-d.length < minRead {
+		keep := d.length - d.start
+		buf := make([]byte, keep, 2*keep+minRead)
+		copy(buf, d.data[d.start:d.length])
+
+		d.offset += int64(d.start)
+		d.cursor -= d.start
+		d.start = 0
+		d.data = buf
+		d.length = keep
+	}
+
+	end := cap(d.data)
+	if limit := d.limits.MaxInputSize; limit > 0 {
+		left := limit - d.offset - int64(d.length)
+		if left <= 0 {
+			return d.probeEOF()
+		}
+		if left < int64(end-d.length) {
+			end = d.length + int(left)
+		}
+	}
+
+	for {
+		n, err := d.r.Read(d.data[d.length:end])
+		d.length += n
+		d.data = d.data[:d.length]
+		if err != nil {
+			d.rerr = err
+		}
+		switch {
+		case n > 0:
+			return nil
+		case err != nil:
+			return d.refill()
+		}
+	}
+}
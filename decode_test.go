@@ -2,8 +2,14 @@ package bencode
 
 import (
 	"bytes"
+	"errors"
+	"io"
+	"math"
+	"math/big"
 	"reflect"
+	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 type unmarshalTestCase struct {
@@ -270,6 +276,919 @@ func TestUnmarshalMap(t *testing.T) {
 	testLoopUnmarshal(t, tcs)
 }
 
+func TestUnmarshalStruct(t *testing.T) {
+	type inner struct {
+		X int64 `bencode:"x"`
+	}
+	type Embedded struct {
+		E string `bencode:"e"`
+	}
+	type foo struct {
+		Embedded
+		A          string `bencode:"a-field"`
+		B          int    `bencode:"-"`
+		C          int    `bencode:"c-int-field,omitempty"`
+		D          map[string]any
+		P          *inner `bencode:"p"`
+		L          []any  `bencode:"l"`
+		R          []byte `bencode:"r"`
+		unexported int
+	}
+
+	var got foo
+	input := `d1:Dd1:xi42ee7:a-field2:aa1:Bi10e11:c-int-fieldi1e1:e3:emb1:lli1ee1:pd1:xi7ee1:r3:raw7:unknowni1ee`
+	if err := Unmarshal([]byte(input), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := foo{
+		Embedded: Embedded{E: "emb"},
+		A:        "aa",
+		C:        1,
+		D:        map[string]any{"x": int64(42)},
+		P:        &inner{X: 7},
+		L:        []any{int64(1)},
+		R:        []byte("raw"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v want: %+v", got, want)
+	}
+}
+
+func TestUnmarshalStructShadowing(t *testing.T) {
+	type Inner struct {
+		Name string `bencode:"name"`
+		Size int
+	}
+	type Other struct {
+		Name string `bencode:"name"`
+		Size int    `bencode:"Size"`
+	}
+	type shadow struct {
+		Inner
+		Name string `bencode:"name"`
+	}
+	type conflict struct {
+		Inner
+		Other
+	}
+
+	var got shadow
+	if err := Unmarshal([]byte(`d4:Sizei1e4:name3:fooe`), &got); err != nil {
+		t.Fatal(err)
+	}
+	if want := (shadow{Inner: Inner{Size: 1}, Name: "foo"}); got != want {
+		t.Fatalf("got %+v want: %+v", got, want)
+	}
+
+	var got2 conflict
+	if err := Unmarshal([]byte(`d4:Sizei1e4:name3:fooe`), &got2); err != nil {
+		t.Fatal(err)
+	}
+	if want := (conflict{Other: Other{Size: 1}}); got2 != want {
+		t.Fatalf("got %+v want: %+v", got2, want)
+	}
+}
+
+func TestUnmarshalStructEmbedded(t *testing.T) {
+	type Inner struct {
+		X int `bencode:"x"`
+	}
+	type outerPtr struct {
+		*Inner
+		Y int `bencode:"y"`
+	}
+	type outerUnexported struct {
+		embeddedInner
+		Y int `bencode:"y"`
+	}
+
+	var o outerPtr
+	if err := Unmarshal([]byte(`d1:xi1e1:yi2ee`), &o); err != nil {
+		t.Fatal(err)
+	}
+	if o.Inner == nil || o.X != 1 || o.Y != 2 {
+		t.Fatalf("got %+v", o)
+	}
+
+	var u outerUnexported
+	if err := Unmarshal([]byte(`d1:xi1e1:yi2ee`), &u); err != nil {
+		t.Fatal(err)
+	}
+	if u.X != 1 || u.Y != 2 {
+		t.Fatalf("got %+v", u)
+	}
+
+	// unexported embedded pointer cannot be allocated, the value is skipped
+	var p embeddedPtr
+	if err := Unmarshal([]byte(`d1:xi1e1:yi2ee`), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.embeddedInner != nil || p.Y != 2 {
+		t.Fatalf("got %+v", p)
+	}
+	p.embeddedInner = &embeddedInner{}
+	if err := Unmarshal([]byte(`d1:xi1e1:yi2ee`), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.X != 1 {
+		t.Fatalf("got %+v", p)
+	}
+}
+
+func TestUnmarshalStructRoundTrip(t *testing.T) {
+	type Embedded struct {
+		Name string `bencode:"name"`
+	}
+	type file struct {
+		Length int64  `bencode:"length"`
+		Path   []any  `bencode:"path"`
+		MD5    []byte `bencode:"md5sum,omitempty"`
+	}
+	type info struct {
+		Embedded
+		PieceLength int64  `bencode:"piece length"`
+		File        *file  `bencode:"file"`
+		Private     uint8  `bencode:"private,omitempty"`
+		Comment     string `bencode:"comment,omitempty"`
+	}
+
+	want := info{
+		Embedded:    Embedded{Name: "debian.iso"},
+		PieceLength: 262144,
+		File:        &file{Length: 42, Path: []any{[]byte("a"), []byte("b")}},
+		Private:     1,
+	}
+
+	raw, err := Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got info
+	if err := Unmarshal(raw, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v want: %+v", got, want)
+	}
+}
+
+func TestUnmarshalStructErrors(t *testing.T) {
+	type foo struct {
+		A string `bencode:"a"`
+		N int    `bencode:"n"`
+	}
+
+	tcs := []string{
+		`li1ee`,
+		`i1e`,
+		`d1:ai1ee`,
+		`d1:n3:fooe`,
+		`d1:a`,
+	}
+	for i, input := range tcs {
+		var got foo
+		if err := Unmarshal([]byte(input), &got); err == nil {
+			t.Fatalf("[test %d] want error for %q", i+1, input)
+		}
+	}
+
+	var got foo
+	if err := Unmarshal([]byte(`de`), got); err == nil || !strings.Contains(err.Error(), "non-pointer") {
+		t.Fatalf("want error for non-pointer, got %v", err)
+	}
+	if err := Unmarshal([]byte(`i1e`), (*int)(nil)); err == nil || !strings.Contains(err.Error(), "cannot decode into nil *int") {
+		t.Fatalf("want error for nil pointer, got %v", err)
+	}
+	if err := Unmarshal([]byte(`i1e`), (*any)(nil)); err == nil || !strings.Contains(err.Error(), "cannot decode into nil *interface {}") {
+		t.Fatalf("want error for nil pointer, got %v", err)
+	}
+}
+
+type rawCapture struct {
+	raw string
+}
+
+func (r *rawCapture) UnmarshalBencode(b []byte) error {
+	r.raw = string(b)
+	return nil
+}
+
+type failingUnmarshaler struct{}
+
+func (failingUnmarshaler) UnmarshalBencode([]byte) error {
+	return errors.New("oops")
+}
+
+func TestUnmarshalUnmarshaler(t *testing.T) {
+	var top rawCapture
+	if err := Unmarshal([]byte(`d1:ali1ei2eee`), &top); err != nil {
+		t.Fatal(err)
+	}
+	if want := `d1:ali1ei2eee`; top.raw != want {
+		t.Fatalf("got %q want: %q", top.raw, want)
+	}
+
+	type foo struct {
+		A rawCapture            `bencode:"a"`
+		B *rawCapture           `bencode:"b"`
+		L []rawCapture          `bencode:"l"`
+		M map[string]rawCapture `bencode:"m"`
+		N int                   `bencode:"n"`
+	}
+
+	var got foo
+	input := `d1:ad1:xi1ee1:b3:foo1:llli1ee4:spame1:md1:ki-5ee1:ni3ee`
+	if err := Unmarshal([]byte(input), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := foo{
+		A: rawCapture{`d1:xi1ee`},
+		B: &rawCapture{`3:foo`},
+		L: []rawCapture{{`li1ee`}, {`4:spam`}},
+		M: map[string]rawCapture{"k": {`i-5e`}},
+		N: 3,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v want: %+v", got, want)
+	}
+
+	var fail struct {
+		F failingUnmarshaler `bencode:"f"`
+	}
+	if err := Unmarshal([]byte(`d1:fi1ee`), &fail); err == nil {
+		t.Fatal("want error")
+	}
+}
+
+func TestUnmarshalTypedContainers(t *testing.T) {
+	var list [][]any
+	if err := Unmarshal([]byte(`lli1eeli2eee`), &list); err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]any{{int64(1)}, {int64(2)}}; !reflect.DeepEqual(list, want) {
+		t.Fatalf("got %v want: %v", list, want)
+	}
+
+	var dict map[string][]any
+	if err := Unmarshal([]byte(`d1:ali1ee1:ble1:cl1:xee`), &dict); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]any{
+		"a": {int64(1)},
+		"b": {},
+		"c": {[]byte("x")},
+	}
+	if !reflect.DeepEqual(dict, want) {
+		t.Fatalf("got %v want: %v", dict, want)
+	}
+}
+
+func TestUnmarshalTyped(t *testing.T) {
+	type hash [20]byte
+	type name string
+
+	tcs := []struct {
+		input   string
+		into    any
+		want    any
+		wantErr bool
+	}{
+		{`i42e`, new(int), 42, false},
+		{`i-128e`, new(int8), int8(-128), false},
+		{`i-129e`, new(int8), nil, true},
+		{`i32767e`, new(int16), int16(32767), false},
+		{`i2147483648e`, new(int32), nil, true},
+		{`i9223372036854775807e`, new(int64), int64(9223372036854775807), false},
+		{`i255e`, new(uint8), uint8(255), false},
+		{`i256e`, new(uint8), nil, true},
+		{`i-1e`, new(uint), nil, true},
+		{`i65535e`, new(uint16), uint16(65535), false},
+		{`i4294967295e`, new(uint32), uint32(4294967295), false},
+		{`i1e`, new(bool), true, false},
+		{`i0e`, new(bool), false, false},
+		{`i2e`, new(bool), nil, true},
+		{`3:foo`, new(string), "foo", false},
+		{`3:foo`, new(name), name("foo"), false},
+		{`3:foo`, new([]byte), []byte("foo"), false},
+		{`3:foo`, new([3]byte), [3]byte{'f', 'o', 'o'}, false},
+		{`20:aaaaaaaaaaaaaaaaaaaa`, new(hash), hash{'a', 'a', 'a', 'a', 'a', 'a', 'a', 'a', 'a', 'a', 'a', 'a', 'a', 'a', 'a', 'a', 'a', 'a', 'a', 'a'}, false},
+		{`19:aaaaaaaaaaaaaaaaaaa`, new(hash), nil, true},
+		{`l3:foo3:bare`, new([]string), []string{"foo", "bar"}, false},
+		{`le`, new([]string), []string{}, false},
+		{`li1ei2ee`, new([2]int), [2]int{1, 2}, false},
+		{`li1ee`, new([2]int), nil, true},
+		{`li1ei2ei3ee`, new([2]int), nil, true},
+		{`ll1:ae1:be`, new([][]string), nil, true},
+		{`d1:ai1e1:bi2ee`, new(map[string]int), map[string]int{"a": 1, "b": 2}, false},
+		{`d1:a1:be`, new(map[name]name), map[name]name{"a": "b"}, false},
+		{`d1:a1:be`, new(map[string]int), nil, true},
+		{`i1e`, new(string), nil, true},
+		{`3:foo`, new(int), nil, true},
+		{`le`, new(map[string]int), nil, true},
+		{`de`, new([]int), nil, true},
+		{`3:1.5`, new(float64), nil, true},
+		{`i1e`, new(error), nil, true},
+		{`i1e`, new(map[string]any), nil, true},
+		{`3:foo`, new(map[string]any), nil, true},
+		{`de`, new([]any), nil, true},
+		{`i1e`, new([]any), nil, true},
+	}
+
+	for i, test := range tcs {
+		err := Unmarshal([]byte(test.input), test.into)
+		if test.wantErr {
+			if err == nil {
+				t.Fatalf("[test %d] want error, got %v", i+1, reflect.ValueOf(test.into).Elem())
+			}
+			var typeErr *UnmarshalTypeError
+			if !errors.As(err, &typeErr) {
+				t.Fatalf("[test %d] want UnmarshalTypeError, got %v", i+1, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("[test %d] unexpected err %v", i+1, err)
+		}
+
+		got := reflect.ValueOf(test.into).Elem().Interface()
+		if !reflect.DeepEqual(got, test.want) {
+			t.Fatalf("[test %d] got %v want: %v", i+1, got, test.want)
+		}
+	}
+}
+
+func TestDecoderStream(t *testing.T) {
+	input := `i1e3:food1:ai2ee` + `l` + strings.Repeat(`10:0123456789`, 100) + `e` + `4:spam`
+
+	readers := map[string]func() io.Reader{
+		"reader":  func() io.Reader { return strings.NewReader(input) },
+		"onebyte": func() io.Reader { return iotest.OneByteReader(strings.NewReader(input)) },
+		"dataerr": func() io.Reader { return iotest.DataErrReader(strings.NewReader(input)) },
+	}
+
+	for name, newReader := range readers {
+		d := NewDecoder(newReader())
+
+		var n int
+		mustDecode(t, d, &n)
+		if n != 1 {
+			t.Fatalf("%s: got %v", name, n)
+		}
+		if off := d.InputOffset(); off != 3 {
+			t.Fatalf("%s: got offset %d", name, off)
+		}
+
+		var foo []byte
+		mustDecode(t, d, &foo)
+
+		var m map[string]int
+		mustDecode(t, d, &m)
+		if m["a"] != 2 {
+			t.Fatalf("%s: got %v", name, m)
+		}
+
+		var list []string
+		mustDecode(t, d, &list)
+		if len(list) != 100 || list[99] != "0123456789" {
+			t.Fatalf("%s: got %v", name, list)
+		}
+
+		var spam any
+		mustDecode(t, d, &spam)
+
+		// previously decoded values must not be overwritten by later reads
+		if string(foo) != "foo" || string(spam.([]byte)) != "spam" {
+			t.Fatalf("%s: got %q and %q", name, foo, spam)
+		}
+		if off := d.InputOffset(); off != int64(len(input)) {
+			t.Fatalf("%s: got offset %d want %d", name, off, len(input))
+		}
+		if err := d.Decode(&spam); err != io.EOF {
+			t.Fatalf("%s: want io.EOF, got %v", name, err)
+		}
+	}
+}
+
+func TestDecoderBuffered(t *testing.T) {
+	d := NewDecoder(strings.NewReader(`i42e4:rest`))
+
+	var n int
+	mustDecode(t, d, &n)
+
+	rest, err := io.ReadAll(d.Buffered())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rest) != "4:rest" {
+		t.Fatalf("got %q", rest)
+	}
+}
+
+func TestDecoderStreamErrors(t *testing.T) {
+	tcs := []string{
+		`i42`,
+		`5:abc`,
+		`li1e`,
+		`d1:a`,
+		`d3:key`,
+		`ix1e`,
+	}
+	for i, input := range tcs {
+		var v any
+		err := NewDecoder(strings.NewReader(input)).Decode(&v)
+		if err == nil || err == io.EOF {
+			t.Fatalf("[test %d] want error, got %v", i+1, err)
+		}
+	}
+
+	readErr := errors.New("read failed")
+	r := io.MultiReader(strings.NewReader(`l3:foo`), iotest.ErrReader(readErr))
+	var v any
+	if err := NewDecoder(r).Decode(&v); !errors.Is(err, readErr) {
+		t.Fatalf("want read error, got %v", err)
+	}
+}
+
+func TestDecoderDisallowNonCanonical(t *testing.T) {
+	tcs := []struct {
+		input     string
+		canonical bool
+	}{
+		{`i0e`, true},
+		{`i-1e`, true},
+		{`i10e`, true},
+		{`0:`, true},
+		{`10:0123456789`, true},
+		{`d1:ai1e1:bi2ee`, true},
+		{`d1:ai1e2:aai2e1:bi3ee`, true},
+		{`d0:i1e1:ai2ee`, true},
+		{`ld1:bi1e1:ai2eee`, false},
+		{`i-0e`, false},
+		{`i007e`, false},
+		{`i-01e`, false},
+		{`i+5e`, false},
+		{`ie`, false},
+		{`03:foo`, false},
+		{`+3:foo`, false},
+		{`-0:`, false},
+		{`d1:bi1e1:ai2ee`, false},
+		{`d1:ai1e1:ai2ee`, false},
+		{`d2:aai1e1:ai2ee`, false},
+		{`d1:ad1:bi1e1:ai1eee`, false},
+	}
+
+	for i, test := range tcs {
+		var v any
+		d := NewDecodeBytes([]byte(test.input))
+		d.DisallowNonCanonical()
+		err := d.Decode(&v)
+
+		if test.canonical {
+			if err != nil {
+				t.Fatalf("[test %d] unexpected err %v", i+1, err)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrNonCanonical) {
+			t.Fatalf("[test %d] want ErrNonCanonical for %q, got %v", i+1, test.input, err)
+		}
+
+		// skipping and tokenizing must agree with decoding
+		d = NewDecodeBytes([]byte(test.input))
+		d.DisallowNonCanonical()
+		if err := d.Skip(); !errors.Is(err, ErrNonCanonical) {
+			t.Fatalf("[test %d] want ErrNonCanonical on skip, got %v", i+1, err)
+		}
+
+		d = NewDecodeBytes([]byte(test.input))
+		d.DisallowNonCanonical()
+		for {
+			_, err := d.Token()
+			if errors.Is(err, ErrNonCanonical) {
+				break
+			}
+			if err != nil {
+				t.Fatalf("[test %d] want ErrNonCanonical on token, got %v", i+1, err)
+			}
+		}
+	}
+}
+
+func TestDecoderDisallowNonCanonicalStruct(t *testing.T) {
+	var v struct {
+		A int `bencode:"a"`
+		B int `bencode:"b"`
+	}
+
+	if err := Unmarshal([]byte(`d1:bi1e1:ai2ee`), &v); err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDecodeBytes([]byte(`d1:bi1e1:ai2ee`))
+	d.DisallowNonCanonical()
+	err := d.Decode(&v)
+
+	var syntaxErr *SyntaxError
+	if !errors.As(err, &syntaxErr) || !errors.Is(err, ErrNonCanonical) {
+		t.Fatalf("want SyntaxError, got %v", err)
+	}
+	if syntaxErr.Offset != 7 {
+		t.Fatalf("got offset %d", syntaxErr.Offset)
+	}
+}
+
+func TestDecoderLimits(t *testing.T) {
+	deep := strings.Repeat("l", 100_000) + strings.Repeat("e", 100_000)
+
+	tcs := []struct {
+		input  string
+		limits Limits
+		limit  string
+	}{
+		{deep, Limits{}, "depth"},
+		{`llleee`, Limits{MaxDepth: 2}, "depth"},
+		{`d1:ad1:ad1:aleeee`, Limits{MaxDepth: 3}, "depth"},
+		{`9999999999:`, Limits{MaxStringLength: 1 << 20}, "string length"},
+		{`d3:keyi1ee`, Limits{MaxStringLength: 2}, "string length"},
+		{`li1ei2ei3ee`, Limits{MaxElements: 2}, "elements"},
+		{`li1ei2ei3ei4ee`, Limits{MaxElements: 2}, "elements"},
+		{`d1:ai1e1:bi2e1:ci3ee`, Limits{MaxElements: 2}, "elements"},
+		{`l` + strings.Repeat(`4:spam`, 1000) + `e`, Limits{MaxInputSize: 1000}, "input size"},
+	}
+
+	for i, test := range tcs {
+		decoders := map[string]func() *Decoder{
+			"bytes":  func() *Decoder { return NewDecodeBytes([]byte(test.input)) },
+			"reader": func() *Decoder { return NewDecoder(strings.NewReader(test.input)) },
+		}
+		for name, newDecoder := range decoders {
+			for _, mode := range []string{"decode", "struct", "skip", "token", "tokenskip"} {
+				d := newDecoder()
+				d.SetLimits(test.limits)
+
+				var err error
+				switch mode {
+				case "decode":
+					var v any
+					err = d.Decode(&v)
+				case "struct":
+					var v struct {
+						A []any `bencode:"a"`
+					}
+					err = d.Decode(&v)
+				case "skip":
+					err = d.Skip()
+				case "token":
+					for err == nil {
+						_, err = d.Token()
+					}
+				case "tokenskip":
+					// skip elements of a container opened with Token
+					_, err = d.Token()
+					for err == nil {
+						err = d.Skip()
+					}
+				}
+
+				var limitErr *LimitExceededError
+				if errors.As(err, &limitErr) {
+					if limitErr.Limit != test.limit {
+						t.Fatalf("[test %d] %s %s: got limit %q want: %q", i+1, name, mode, limitErr.Limit, test.limit)
+					}
+					continue
+				}
+
+				// struct decoding can fail earlier on a type mismatch
+				var typeErr *UnmarshalTypeError
+				if mode == "struct" && errors.As(err, &typeErr) {
+					continue
+				}
+				t.Fatalf("[test %d] %s %s: want LimitExceededError, got %v", i+1, name, mode, err)
+			}
+		}
+	}
+}
+
+func TestDecoderLimitsAllowed(t *testing.T) {
+	input := `d1:ali1ei2ee1:b4:spame`
+
+	d := NewDecoder(strings.NewReader(input))
+	d.SetLimits(Limits{
+		MaxDepth:        2,
+		MaxInputSize:    int64(len(input)),
+		MaxStringLength: 4,
+		MaxElements:     2,
+	})
+
+	var v any
+	mustDecode(t, d, &v)
+	if err := d.Decode(&v); err != io.EOF {
+		t.Fatalf("want io.EOF, got %v", err)
+	}
+}
+
+func mustDecode(t *testing.T, d *Decoder, v any) {
+	t.Helper()
+	if err := d.Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnmarshalRawMessage(t *testing.T) {
+	type foo struct {
+		Info RawMessage            `bencode:"info"`
+		Ptr  *RawMessage           `bencode:"ptr"`
+		List []RawMessage          `bencode:"list"`
+		Map  map[string]RawMessage `bencode:"map"`
+		N    int                   `bencode:"n"`
+	}
+
+	input := []byte(`d4:infod6:lengthi1e4:name3:fooe4:listli1e0:e3:mapd1:xle1:yde1:zi-1ee1:ni7e3:ptr3:bare`)
+
+	var got foo
+	if err := Unmarshal(input, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := foo{
+		Info: RawMessage(`d6:lengthi1e4:name3:fooe`),
+		Ptr:  rawPtr(`3:bar`),
+		List: []RawMessage{RawMessage(`i1e`), RawMessage(`0:`)},
+		Map: map[string]RawMessage{
+			"x": RawMessage(`le`),
+			"y": RawMessage(`de`),
+			"z": RawMessage(`i-1e`),
+		},
+		N: 7,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v want: %+v", got, want)
+	}
+
+	// decoded RawMessage points into the input
+	if &got.Info[0] != &input[7] {
+		t.Fatal("RawMessage must not be copied")
+	}
+
+	var top RawMessage
+	if err := NewDecoder(strings.NewReader(`l3:fooe`)).Decode(&top); err != nil {
+		t.Fatal(err)
+	}
+	if string(top) != `l3:fooe` {
+		t.Fatalf("got %q", top)
+	}
+
+	var copied RawMessage
+	if err := copied.UnmarshalBencode(input); err != nil {
+		t.Fatal(err)
+	}
+	if &copied[0] == &input[0] {
+		t.Fatal("UnmarshalBencode must copy")
+	}
+}
+
+func rawPtr(s string) *RawMessage {
+	raw := RawMessage(s)
+	return &raw
+}
+
+func TestUnmarshalBigInt(t *testing.T) {
+	huge := "123456789012345678901234567890"
+	want, _ := new(big.Int).SetString(huge, 10)
+
+	var ptr *big.Int
+	if err := Unmarshal([]byte("i"+huge+"e"), &ptr); err != nil {
+		t.Fatal(err)
+	}
+	if ptr.Cmp(want) != 0 {
+		t.Fatalf("got %v want: %v", ptr, want)
+	}
+
+	var v struct {
+		Big   big.Int  `bencode:"big"`
+		Neg   *big.Int `bencode:"neg"`
+		Small *big.Int `bencode:"small"`
+	}
+	input := "d3:bigi" + huge + "e3:negi-" + huge + "e5:smalli42ee"
+	if err := Unmarshal([]byte(input), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Big.Cmp(want) != 0 || v.Neg.Cmp(new(big.Int).Neg(want)) != 0 || v.Small.Int64() != 42 {
+		t.Fatalf("got %v %v %v", &v.Big, v.Neg, v.Small)
+	}
+
+	// without UseBigInt integer must fit into int64
+	var got any
+	err := Unmarshal([]byte("li1ei"+huge+"ee"), &got)
+	var typeErr *UnmarshalTypeError
+	if !errors.As(err, &typeErr) {
+		t.Fatalf("want UnmarshalTypeError, got %v", err)
+	}
+
+	d := NewDecodeBytes([]byte("li1ei" + huge + "ee"))
+	d.UseBigInt()
+	if err := d.Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	list := got.([]any)
+	if list[0] != int64(1) || list[1].(*big.Int).Cmp(want) != 0 {
+		t.Fatalf("got %v", list)
+	}
+
+	// skipping and raw values must not care about integer size
+	var raw struct {
+		Raw RawMessage `bencode:"raw"`
+	}
+	if err := Unmarshal([]byte("d3:rawli"+huge+"eee"), &raw); err != nil {
+		t.Fatal(err)
+	}
+	if string(raw.Raw) != "li"+huge+"ee" {
+		t.Fatalf("got %q", raw.Raw)
+	}
+
+	for _, input := range []string{`de`, `3:foo`, `i1-2e`} {
+		if err := Unmarshal([]byte(input), &ptr); err == nil {
+			t.Fatalf("want error for %q", input)
+		}
+	}
+}
+
+func TestUnmarshalUint64(t *testing.T) {
+	var u uint64
+	if err := Unmarshal([]byte(`i18446744073709551615e`), &u); err != nil {
+		t.Fatal(err)
+	}
+	if u != math.MaxUint64 {
+		t.Fatalf("got %v", u)
+	}
+
+	for _, input := range []string{`i18446744073709551616e`, `i-1e`} {
+		err := Unmarshal([]byte(input), &u)
+		var typeErr *UnmarshalTypeError
+		if !errors.As(err, &typeErr) {
+			t.Fatalf("want UnmarshalTypeError for %q, got %v", input, err)
+		}
+	}
+
+	var v struct {
+		Uploaded uint64 `bencode:"uploaded"`
+	}
+	raw, err := Marshal(struct {
+		Uploaded uint64 `bencode:"uploaded"`
+	}{1 << 63})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Unmarshal(raw, &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Uploaded != 1<<63 {
+		t.Fatalf("got %v", v.Uploaded)
+	}
+
+	var got any
+	if err := Unmarshal([]byte(`i9223372036854775808e`), &got); err == nil {
+		t.Fatal("want error without UseUint64")
+	}
+
+	d := NewDecodeBytes([]byte(`li-1ei9223372036854775808ei18446744073709551616ee`))
+	d.UseUint64()
+	d.UseBigInt()
+	if err := d.Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	list := got.([]any)
+	if list[0] != int64(-1) || list[1] != uint64(1<<63) {
+		t.Fatalf("got %v", list)
+	}
+	if list[2].(*big.Int).String() != "18446744073709551616" {
+		t.Fatalf("got %v", list[2])
+	}
+}
+
+func TestFloatPolicy(t *testing.T) {
+	type foo struct {
+		F32 float32 `bencode:"f32"`
+		F64 float64 `bencode:"f64"`
+	}
+	value := foo{F32: 3.14, F64: -456.1234}
+
+	tcs := []struct {
+		policy FloatPolicy
+		want   string
+	}{
+		{FloatBits, `d3:f32i1078523331e3:f64i-4576640212951153351ee`},
+		{FloatString, `d3:f324:3.143:f649:-456.1234e`},
+	}
+
+	for _, test := range tcs {
+		buf := &bytes.Buffer{}
+		enc := NewEncoder(buf)
+		enc.SetFloatPolicy(test.policy)
+		if err := enc.Encode(value); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != test.want {
+			t.Fatalf("got %s want: %s", buf.String(), test.want)
+		}
+
+		var got foo
+		dec := NewDecodeBytes(buf.Bytes())
+		dec.SetFloatPolicy(test.policy)
+		if err := dec.Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != value {
+			t.Fatalf("got %v want: %v", got, value)
+		}
+
+		// other policies cannot decode it
+		dec = NewDecodeBytes(buf.Bytes())
+		dec.SetFloatPolicy(FloatError)
+		var typeErr *UnmarshalTypeError
+		if err := dec.Decode(&got); !errors.As(err, &typeErr) {
+			t.Fatalf("want UnmarshalTypeError, got %v", err)
+		}
+	}
+
+	enc := NewEncoder(&bytes.Buffer{})
+	enc.SetFloatPolicy(FloatError)
+	err := enc.Encode(value)
+	if err == nil || strings.Count(err.Error(), "bencode:") != 1 {
+		t.Fatalf("want single prefixed error, got %v", err)
+	}
+
+	dec := NewDecodeBytes([]byte(`3:abc`))
+	dec.SetFloatPolicy(FloatString)
+	var f float64
+	if err := dec.Decode(&f); err == nil {
+		t.Fatal("want error")
+	}
+}
+
+func TestUnmarshalMapKeys(t *testing.T) {
+	type hash [4]byte
+	type name string
+
+	var named map[name]int
+	if err := Unmarshal([]byte(`d1:ai1e1:bi2ee`), &named); err != nil {
+		t.Fatal(err)
+	}
+	if want := (map[name]int{"a": 1, "b": 2}); !reflect.DeepEqual(named, want) {
+		t.Fatalf("got %v want: %v", named, want)
+	}
+
+	var hashes map[hash]int
+	if err := Unmarshal([]byte("d4:a\xff\x00\x00i2e4:z\x00\x00\x01i1ee"), &hashes); err != nil {
+		t.Fatal(err)
+	}
+	if want := (map[hash]int{{'z', 0, 0, 1}: 1, {'a', 0xff, 0, 0}: 2}); !reflect.DeepEqual(hashes, want) {
+		t.Fatalf("got %v want: %v", hashes, want)
+	}
+
+	var texts map[textKey]int
+	if err := Unmarshal([]byte(`d3:a/2i2e3:b/1i1ee`), &texts); err != nil {
+		t.Fatal(err)
+	}
+	if want := (map[textKey]int{{"b", "1"}: 1, {"a", "2"}: 2}); !reflect.DeepEqual(texts, want) {
+		t.Fatalf("got %v want: %v", texts, want)
+	}
+
+	// round trip of a scrape response keyed by raw info-hashes
+	type stats struct {
+		Complete int `bencode:"complete"`
+	}
+	scrape := map[[20]byte]stats{
+		{1, 2, 3}:    {Complete: 5},
+		{0xff, 0xfe}: {Complete: 7},
+	}
+	raw, err := Marshal(scrape)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotScrape map[[20]byte]stats
+	if err := Unmarshal(raw, &gotScrape); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotScrape, scrape) {
+		t.Fatalf("got %v want: %v", gotScrape, scrape)
+	}
+
+	var typeErr *UnmarshalTypeError
+	if err := Unmarshal([]byte(`d3:abci1ee`), &hashes); !errors.As(err, &typeErr) {
+		t.Fatalf("want UnmarshalTypeError, got %v", err)
+	}
+	if err := Unmarshal([]byte(`d1:ai1ee`), new(map[int]int)); !errors.As(err, &typeErr) {
+		t.Fatalf("want UnmarshalTypeError, got %v", err)
+	}
+	if err := Unmarshal([]byte(`d3:abci1ee`), &texts); err == nil {
+		t.Fatal("want error")
+	}
+}
+
 func testLoopUnmarshal(t *testing.T, tcs []unmarshalTestCase) {
 	t.Helper()
 
@@ -319,3 +1238,208 @@ func Benchmark_UnmarshalReader(b *testing.B) {
 		}
 	}
 }
+
+func TestDecoderUseOrdered(t *testing.T) {
+	const input = `d1:bi1e1:ad1:yi2e1:xl3:fooee1:bi3ee`
+	want := D{
+		{"b", int64(1)},
+		{"a", D{{"y", int64(2)}, {"x", A{[]byte("foo")}}}},
+		{"b", int64(3)},
+	}
+
+	var dict D
+	if err := Unmarshal([]byte(input), &dict); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dict, want) {
+		t.Fatalf("got %#v want %#v", dict, want)
+	}
+
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.PreserveOrder()
+	if err := enc.Encode(dict); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != input {
+		t.Fatalf("got %s want %s", buf.String(), input)
+	}
+
+	var got any
+	d := NewDecodeBytes([]byte(input))
+	d.UseOrdered()
+	if err := d.Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %#v want %#v", got, want)
+	}
+
+	var list []any
+	d = NewDecodeBytes([]byte(`ld1:ai1eeli2eee`))
+	d.UseOrdered()
+	if err := d.Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if wantList := []any{D{{"a", int64(1)}}, A{int64(2)}}; !reflect.DeepEqual(list, wantList) {
+		t.Fatalf("got %#v want %#v", list, wantList)
+	}
+
+	var v struct {
+		Info D `bencode:"info"`
+		List A `bencode:"list"`
+	}
+	if err := Unmarshal([]byte(`d4:infod1:bi1e1:ai2ee4:listld1:ai1eeee`), &v); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v.Info, D{{"b", int64(1)}, {"a", int64(2)}}) || !reflect.DeepEqual(v.List, A{D{{"a", int64(1)}}}) {
+		t.Fatalf("got %#v", v)
+	}
+
+	for _, input := range []string{`li1ee`, `i1e`} {
+		var typeErr *UnmarshalTypeError
+		if err := Unmarshal([]byte(input), &dict); !errors.As(err, &typeErr) {
+			t.Fatalf("want UnmarshalTypeError for %q, got %v", input, err)
+		}
+	}
+	var a A
+	var typeErr *UnmarshalTypeError
+	if err := Unmarshal([]byte(`de`), &a); !errors.As(err, &typeErr) {
+		t.Fatalf("want UnmarshalTypeError, got %v", err)
+	}
+}
+
+func TestDecoderUseStrings(t *testing.T) {
+	input := []byte(`d1:a3:foo1:bl3:bare1:ci1ee`)
+
+	var got any
+	d := NewDecodeBytes(input)
+	d.UseStrings()
+	if err := d.Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"a": "foo", "b": []any{"bar"}, "c": int64(1)}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %#v want %#v", got, want)
+	}
+
+	var v struct {
+		A any    `bencode:"a"`
+		B []byte `bencode:"b"`
+	}
+	d = NewDecodeBytes([]byte(`d1:a3:foo1:b3:bare`))
+	d.UseStrings()
+	if err := d.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v.A != "foo" || string(v.B) != "bar" {
+		t.Fatalf("got %#v", v)
+	}
+}
+
+func TestDecoderCopyBytes(t *testing.T) {
+	var v struct {
+		A any        `bencode:"a"`
+		B []byte     `bencode:"b"`
+		R RawMessage `bencode:"r"`
+	}
+
+	input := []byte(`d1:a3:foo1:b3:bar1:ri1ee`)
+	if err := Unmarshal(input, &v); err != nil {
+		t.Fatal(err)
+	}
+	copy(input, bytes.Repeat([]byte{'x'}, len(input)))
+	if string(v.A.([]byte)) != "xxx" || string(v.B) != "xxx" || string(v.R) != "xxx" {
+		t.Fatalf("want values pointing into the input, got %#v", v)
+	}
+
+	input = []byte(`d1:a3:foo1:b3:bar1:ri1ee`)
+	d := NewDecodeBytes(input)
+	d.CopyBytes()
+	if err := d.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	copy(input, bytes.Repeat([]byte{'x'}, len(input)))
+	if string(v.A.([]byte)) != "foo" || string(v.B) != "bar" || string(v.R) != "i1e" {
+		t.Fatalf("got %#v", v)
+	}
+}
+
+func TestUnmarshalKeysCopied(t *testing.T) {
+	input := []byte(`d3:fooi1e3:bard3:bazi2eee`)
+
+	var m map[string]any
+	if err := Unmarshal(input, &m); err != nil {
+		t.Fatal(err)
+	}
+	var typed map[string]int
+	if err := Unmarshal([]byte(`d3:fooi1ee`), &typed); err != nil {
+		t.Fatal(err)
+	}
+	var dict D
+	if err := Unmarshal(input, &dict); err != nil {
+		t.Fatal(err)
+	}
+
+	copy(input, bytes.Repeat([]byte{'x'}, len(input)))
+	want := map[string]any{"foo": int64(1), "bar": map[string]any{"baz": int64(2)}}
+	if !reflect.DeepEqual(m, want) {
+		t.Fatalf("got %#v want %#v", m, want)
+	}
+	if dict[0].K != "foo" || dict[1].K != "bar" || dict[1].V.(D)[0].K != "baz" {
+		t.Fatalf("got %#v", dict)
+	}
+
+	d := NewDecoder(strings.NewReader(`d1:ai1eed1:ai2ee`))
+	for i := int64(1); i <= 2; i++ {
+		if err := d.Decode(&m); err != nil {
+			t.Fatal(err)
+		}
+		if m["a"] != i {
+			t.Fatalf("got %v", m)
+		}
+	}
+	if len(d.keys) != 1 {
+		t.Fatalf("want 1 interned key, got %v", d.keys)
+	}
+
+	d = NewDecodeBytes([]byte(`d3:fooi1ee`))
+	d.UseUnsafeKeys()
+	if err := d.Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	if m["foo"] != int64(1) || len(d.keys) != 0 {
+		t.Fatalf("got %v", m)
+	}
+}
+
+func TestUnmarshalTrailingData(t *testing.T) {
+	for _, input := range []string{`i1eGARBAGE`, `dei1e`, `0:0:`, `le `} {
+		var v any
+		err := Unmarshal([]byte(input), &v)
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) || !errors.Is(err, ErrTrailingData) {
+			t.Fatalf("want trailing data error for %q, got %v", input, err)
+		}
+	}
+
+	var syntaxErr *SyntaxError
+	var n int
+	if err := Unmarshal([]byte(`i1eGARBAGE`), &n); !errors.As(err, &syntaxErr) || syntaxErr.Offset != 3 {
+		t.Fatalf("got %v", err)
+	}
+
+	// framed message followed by a payload
+	input := []byte(`d8:msg_typei1e5:piecei0e10:total_sizei5ee` + "HELLO")
+	var msg struct {
+		Type int `bencode:"msg_type"`
+		Size int `bencode:"total_size"`
+	}
+	d := NewDecodeBytes(input)
+	if err := d.Decode(&msg); err != nil {
+		t.Fatal(err)
+	}
+	if payload := input[d.InputOffset():]; string(payload) != "HELLO" || msg.Size != 5 {
+		t.Fatalf("got %q %+v", payload, msg)
+	}
+}
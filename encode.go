@@ -1,10 +1,12 @@
 package bencode
 
 import (
+	"encoding"
 	"errors"
 	"fmt"
 	"io"
 	"math"
+	"math/big"
 	"reflect"
 	"sort"
 	"strconv"
@@ -14,6 +16,9 @@ import (
 type Encoder struct {
 	w   io.Writer
 	buf []byte
+
+	floatPolicy   FloatPolicy
+	preserveOrder bool
 }
 
 // NewEncoder returns a new encoder that writes to w.
@@ -29,6 +34,19 @@ func NewEncoderWithBuffer(w io.Writer, buf []byte) *Encoder {
 	}
 }
 
+// SetFloatPolicy sets how floating point numbers are encoded.
+// Default is FloatBits.
+func (e *Encoder) SetFloatPolicy(p FloatPolicy) {
+	e.floatPolicy = p
+}
+
+// PreserveOrder causes the Encoder to write keys of D in the given order
+// without sorting and duplicate checks. This allows to reproduce
+// a non-canonical input byte-for-byte, the output might be invalid Bencode.
+func (e *Encoder) PreserveOrder() {
+	e.preserveOrder = true
+}
+
 // Encode writes the Bencode encoding of v to the stream.
 func (e *Encoder) Encode(v any) error {
 	e.buf = e.buf[:0]
@@ -65,9 +83,17 @@ func (e *Encoder) marshal(v any) error {
 		e.marshalIntGen(v)
 
 	case float32:
-		e.marshalInt(int64(math.Float32bits(v)))
+		return e.marshalFloat(float64(v), 32)
 	case float64:
-		e.marshalInt(int64(math.Float64bits(v)))
+		return e.marshalFloat(v, 64)
+
+	case *big.Int:
+		if v == nil {
+			return errors.New("cannot marshal nil *big.Int")
+		}
+		e.marshalBigInt(v)
+	case big.Int:
+		e.marshalBigInt(&v)
 
 	case bool:
 		var n int64
@@ -76,6 +102,17 @@ func (e *Encoder) marshal(v any) error {
 		}
 		e.marshalInt(n)
 
+	case RawMessage:
+		if len(v) == 0 {
+			return errors.New("cannot marshal empty RawMessage")
+		}
+		e.buf = append(e.buf, v...)
+	case *RawMessage:
+		if v == nil {
+			return e.marshalReflect(reflect.ValueOf(v))
+		}
+		return e.marshal(*v)
+
 	case Marshaler:
 		raw, err := v.MarshalBencode()
 		if err != nil {
@@ -127,7 +164,8 @@ func (e *Encoder) marshalIntGen(val any) {
 	case int:
 		num = int64(val)
 	case uint64:
-		num = int64(val)
+		e.marshalUint(val)
+		return
 	case uint32:
 		num = int64(val)
 	case uint16:
@@ -135,17 +173,49 @@ func (e *Encoder) marshalIntGen(val any) {
 	case uint8:
 		num = int64(val)
 	case uint:
-		num = int64(val)
+		e.marshalUint(uint64(val))
+		return
 	}
 	e.marshalInt(num)
 }
 
+func (e *Encoder) marshalUint(num uint64) {
+	var bs [20]byte // max_str_len( math.MaxUint64 ) base 10
+	buf := strconv.AppendUint(bs[0:0], num, 10)
+	e.buf = append(e.buf, 'i')
+	e.buf = append(e.buf, buf...)
+	e.buf = append(e.buf, 'e')
+}
+
 func (e *Encoder) marshalInt(num int64) {
 	e.buf = append(e.buf, 'i')
 	e.writeInt(num)
 	e.buf = append(e.buf, 'e')
 }
 
+func (e *Encoder) marshalFloat(f float64, bitSize int) error {
+	switch e.floatPolicy {
+	case FloatBits:
+		if bitSize == 32 {
+			e.marshalInt(int64(math.Float32bits(float32(f))))
+		} else {
+			e.marshalInt(int64(math.Float64bits(f)))
+		}
+	case FloatString:
+		var bs [32]byte
+		e.marshalBytes(strconv.AppendFloat(bs[:0], f, 'g', -1, bitSize))
+	default:
+		return fmt.Errorf("cannot marshal float %v", f)
+	}
+	return nil
+}
+
+func (e *Encoder) marshalBigInt(n *big.Int) {
+	e.buf = append(e.buf, 'i')
+	e.buf = n.Append(e.buf, 10)
+	e.buf = append(e.buf, 'e')
+}
+
 func (e *Encoder) marshalReflect(val reflect.Value) error {
 	switch val.Kind() {
 	case reflect.Slice:
@@ -165,6 +235,17 @@ func (e *Encoder) marshalReflect(val reflect.Value) error {
 		}
 		return e.marshal(val.Elem().Interface())
 
+	case reflect.String:
+		return encodeString(e, val)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return encodeInt(e, val)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return encodeUint(e, val)
+	case reflect.Bool:
+		return encodeBool(e, val)
+	case reflect.Float32, reflect.Float64:
+		return encodeFloat(e, val)
+
 	default:
 		return fmt.Errorf("unknown kind: %q", val)
 	}
@@ -213,29 +294,30 @@ func (e *Encoder) marshalList(val reflect.Value) error {
 }
 
 func (e *Encoder) marshalMap(val reflect.Value) error {
-	rawKeys := val.MapKeys()
-	if len(rawKeys) == 0 {
+	if val.Len() == 0 {
 		e.buf = append(e.buf, "de"...)
 		return nil
 	}
 
-	keys := make([]string, len(rawKeys))
-
-	for i, key := range rawKeys {
-		if key.Kind() != reflect.String {
-			return errors.New("map can be marshaled only if keys are of type 'string'")
+	pairs := make(mapPairs, 0, val.Len())
+	iter := val.MapRange()
+	for iter.Next() {
+		key, err := mapKey(iter.Key())
+		if err != nil {
+			return err
 		}
-		keys[i] = key.String()
+		pairs = append(pairs, mapPair{key: key, value: iter.Value()})
 	}
 
-	sortStrings(keys)
+	sort.Sort(pairs)
 
 	e.buf = append(e.buf, 'd')
-	for _, key := range keys {
-		e.marshalString(key)
-
-		value := val.MapIndex(reflect.ValueOf(key))
-		if err := e.marshal(value.Interface()); err != nil {
+	for i, pair := range pairs {
+		if i > 0 && pairs[i-1].key == pair.key {
+			return fmt.Errorf("duplicate map key %q", pair.key)
+		}
+		e.marshalString(pair.key)
+		if err := e.marshal(pair.value.Interface()); err != nil {
 			return err
 		}
 	}
@@ -243,20 +325,58 @@ func (e *Encoder) marshalMap(val reflect.Value) error {
 	return nil
 }
 
-func (e *Encoder) marshalStruct(x reflect.Value) error {
-	dict := make(dictStruct, 0, x.Type().NumField())
+type mapPairs []mapPair
+
+type mapPair struct {
+	key   string
+	value reflect.Value
+}
+
+func (p mapPairs) Len() int           { return len(p) }
+func (p mapPairs) Less(i, j int) bool { return p[i].key < p[j].key }
+func (p mapPairs) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// mapKey returns raw bytes of a dictionary key for the map key k.
+// Supported keys are strings, encoding.TextMarshaler and byte arrays.
+func mapKey(k reflect.Value) (string, error) {
+	switch {
+	case k.Kind() == reflect.String:
+		return k.String(), nil
+
+	case k.Type().Implements(textMarshalerType):
+		if k.Kind() == reflect.Ptr && k.IsNil() {
+			return "", nil
+		}
+		b, err := k.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(b), err
+
+	case k.Kind() == reflect.Array && k.Type().Elem().Kind() == reflect.Uint8:
+		b := make([]byte, k.Len())
+		for i := range b {
+			b[i] = byte(k.Index(i).Uint())
+		}
+		return string(b), nil
 
-	dict, err := walkStruct(dict, x)
-	if err != nil {
-		return err
+	default:
+		return "", fmt.Errorf("map key of type %s is not supported", k.Type())
 	}
+}
 
-	sort.Sort(dict)
+func (e *Encoder) marshalStruct(x reflect.Value) error {
+	fields := cachedFields(x.Type())
 
 	e.buf = append(e.buf, 'd')
-	for _, def := range dict {
-		e.marshalString(def.Key)
-		if err := e.marshal(def.Value.Interface()); err != nil {
+	for i := range fields.list {
+		f := &fields.list[i]
+		field, ok := fieldByIndex(x, f.index)
+		if !ok || isNil(field) || (f.omitEmpty && isZero(field)) {
+			continue
+		}
+
+		e.buf = append(e.buf, f.key...)
+		if err := f.encode(e, field); err != nil {
 			return err
 		}
 	}
@@ -264,45 +384,78 @@ func (e *Encoder) marshalStruct(x reflect.Value) error {
 	return nil
 }
 
-type dictStruct []dictPair
+// encoderFunc encodes a value of a specific type.
+type encoderFunc func(e *Encoder, v reflect.Value) error
 
-type dictPair struct {
-	Key   string
-	Value reflect.Value
-}
-
-func (d dictStruct) Len() int           { return len(d) }
-func (d dictStruct) Less(i, j int) bool { return d[i].Key < d[j].Key }
-func (d dictStruct) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+var marshalerType = reflect.TypeOf((*Marshaler)(nil)).Elem()
 
-func walkStruct(dict dictStruct, v reflect.Value) (dictStruct, error) {
-	t := v.Type()
-	for i := 0; i < t.NumField(); i++ {
-		strField := t.Field(i)
-		field := v.FieldByIndex(strField.Index)
+// fieldEncoder returns an encoder for a struct field of type t.
+// Types with a special handling in Encoder.marshal use it directly.
+func fieldEncoder(t reflect.Type) encoderFunc {
+	if t.Implements(marshalerType) || t == bigIntType {
+		return encodeAny
+	}
 
-		if !field.CanInterface() || isNil(field) {
-			continue
+	switch t.Kind() {
+	case reflect.String:
+		return encodeString
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return encodeInt
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return encodeUint
+	case reflect.Bool:
+		return encodeBool
+	case reflect.Float32, reflect.Float64:
+		return encodeFloat
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return encodeBytes
 		}
+	case reflect.Struct:
+		return encodeStruct
+	}
+	return encodeAny
+}
 
-		tag, ok := fieldTag(strField, field)
-		if !ok {
-			continue
-		}
+func encodeAny(e *Encoder, v reflect.Value) error {
+	return e.marshal(v.Interface())
+}
 
-		if tag == "" && strField.Anonymous &&
-			strField.Type.Kind() == reflect.Struct {
+func encodeString(e *Encoder, v reflect.Value) error {
+	e.marshalString(v.String())
+	return nil
+}
 
-			var err error
-			dict, err = walkStruct(dict, field)
-			if err != nil {
-				return nil, err
-			}
-		} else {
-			dict = append(dict, dictPair{Key: tag, Value: field})
-		}
+func encodeInt(e *Encoder, v reflect.Value) error {
+	e.marshalInt(v.Int())
+	return nil
+}
+
+func encodeUint(e *Encoder, v reflect.Value) error {
+	e.marshalUint(v.Uint())
+	return nil
+}
+
+func encodeBool(e *Encoder, v reflect.Value) error {
+	var n int64
+	if v.Bool() {
+		n = 1
 	}
-	return dict, nil
+	e.marshalInt(n)
+	return nil
+}
+
+func encodeFloat(e *Encoder, v reflect.Value) error {
+	return e.marshalFloat(v.Float(), v.Type().Bits())
+}
+
+func encodeBytes(e *Encoder, v reflect.Value) error {
+	e.marshalBytes(v.Bytes())
+	return nil
+}
+
+func encodeStruct(e *Encoder, v reflect.Value) error {
+	return e.marshalStruct(v)
 }
 
 func (e *Encoder) marshalDictionaryNew(dict D) error {
@@ -311,13 +464,42 @@ func (e *Encoder) marshalDictionaryNew(dict D) error {
 		return nil
 	}
 
-	// TODO(cristaloleg): maybe reuse sort from util.go ?
-	sort.Slice(dict, func(i, j int) bool {
-		return dict[i].K < dict[j].K
-	})
+	if e.preserveOrder {
+		e.buf = append(e.buf, 'd')
+		for _, pair := range dict {
+			e.marshalString(pair.K)
+			if err := e.marshal(pair.V); err != nil {
+				return err
+			}
+		}
+		e.buf = append(e.buf, 'e')
+		return nil
+	}
+
+	// sort indices, so dict isn't modified
+	// less than `intSliceLen` keys in dict? - take from pool
+	var order []int
+	if len(dict) <= intSliceLen {
+		intArr := getIntArray()
+		defer putIntArray(intArr)
+		order = intArr[:len(dict)]
+	} else {
+		order = make([]int, len(dict))
+	}
+
+	for i := range order {
+		order[i] = i
+	}
+
+	sortDict(dict, order)
 
 	e.buf = append(e.buf, 'd')
-	for _, pair := range dict {
+	for i, idx := range order {
+		pair := dict[idx]
+		if i > 0 && dict[order[i-1]].K == pair.K {
+			return fmt.Errorf("duplicate key %q in D", pair.K)
+		}
+
 		e.marshalString(pair.K)
 		if err := e.marshal(pair.V); err != nil {
 			return err
@@ -1,6 +1,10 @@
 package bencode
 
 import (
+	"errors"
+	"math"
+	"math/big"
+	"strings"
 	"testing"
 )
 
@@ -26,6 +30,11 @@ func TestMarshalInt(t *testing.T) {
 		{uint16(8), `i8e`, false},
 		{uint32(9), `i9e`, false},
 		{uint64(10), `i10e`, false},
+		{uint64(1 << 63), `i9223372036854775808e`, false},
+		{uint64(math.MaxUint64), `i18446744073709551615e`, false},
+		{uint(math.MaxUint32), `i4294967295e`, false},
+		{int64(math.MinInt64), `i-9223372036854775808e`, false},
+		{[]uint64{math.MaxUint64}, `li18446744073709551615ee`, false},
 	}
 	testLoopMarshal(t, tcs)
 }
@@ -180,6 +189,41 @@ func TestMarshalMap(t *testing.T) {
 	testLoopMarshal(t, tcs)
 }
 
+type textKey struct {
+	a, b string
+}
+
+func (k textKey) MarshalText() ([]byte, error) {
+	return []byte(k.a + "/" + k.b), nil
+}
+
+func (k *textKey) UnmarshalText(b []byte) error {
+	parts := strings.SplitN(string(b), "/", 2)
+	if len(parts) != 2 {
+		return errors.New("bad key")
+	}
+	k.a, k.b = parts[0], parts[1]
+	return nil
+}
+
+func TestMarshalMapKeys(t *testing.T) {
+	type hash [4]byte
+	type name string
+
+	tcs := []marshalTestCase{
+		{map[name]int{"b": 2, "a": 1}, `d1:ai1e1:bi2ee`, false},
+		{
+			map[hash]int{{'z', 0, 0, 1}: 1, {'a', 0xff, 0, 0}: 2},
+			"d4:a\xff\x00\x00i2e4:z\x00\x00\x01i1ee", false,
+		},
+		{map[[2]byte]string{{'b', 'b'}: "x", {'a', 'a'}: "y"}, `d2:aa1:y2:bb1:xe`, false},
+		{map[textKey]int{{"b", "1"}: 1, {"a", "2"}: 2}, `d3:a/2i2e3:b/1i1ee`, false},
+		{map[int]int{1: 1}, ``, true},
+		{map[[2]int]int{{1, 2}: 1}, ``, true},
+	}
+	testLoopMarshal(t, tcs)
+}
+
 func TestMarshalStruct(t *testing.T) {
 	type foo struct {
 		A string `bencode:"a-field"`
@@ -194,6 +238,32 @@ func TestMarshalStruct(t *testing.T) {
 	type baz struct {
 		A int `bencode:"omitempty"`
 	}
+	type Embedded struct {
+		E int `bencode:"e"`
+	}
+	type qux struct {
+		Embedded
+		Q int `bencode:"q"`
+	}
+	type quux struct {
+		Embedded `bencode:"emb"`
+	}
+	type Inner struct {
+		Name string `bencode:"name"`
+		Size int
+	}
+	type Other struct {
+		Name string `bencode:"name"`
+		Size int    `bencode:"Size"`
+	}
+	type shadow struct {
+		Inner
+		Name string `bencode:"name"`
+	}
+	type conflict struct {
+		Inner
+		Other
+	}
 
 	tcs := []marshalTestCase{
 		{
@@ -206,6 +276,106 @@ func TestMarshalStruct(t *testing.T) {
 		{
 			baz{}, `d9:omitemptyi0ee`, false,
 		},
+		{
+			qux{Embedded{1}, 2}, `d1:ei1e1:qi2ee`, false,
+		},
+		{
+			quux{Embedded{1}}, `d3:embd1:ei1eee`, false,
+		},
+		{
+			// outer field wins even when declared after the embedded struct
+			shadow{Inner{"in", 1}, "out"}, `d4:Sizei1e4:name3:oute`, false,
+		},
+		{
+			// tagged field wins at the same depth, same tags are dropped
+			conflict{Inner{"a", 1}, Other{"b", 2}}, `d4:Sizei2ee`, false,
+		},
+	}
+	testLoopMarshal(t, tcs)
+}
+
+type embeddedInner struct {
+	X int `bencode:"x"`
+}
+
+type embeddedPtr struct {
+	*embeddedInner
+	Y int `bencode:"y"`
+}
+
+func TestMarshalStructEmbedded(t *testing.T) {
+	type Inner struct {
+		X int `bencode:"x"`
+	}
+	type outerPtr struct {
+		*Inner
+		Y int `bencode:"y"`
+	}
+	type outerUnexported struct {
+		embeddedInner
+		Y int `bencode:"y"`
+	}
+	type Node struct {
+		*Node
+		V int `bencode:"v"`
+	}
+
+	tcs := []marshalTestCase{
+		{outerPtr{&Inner{X: 1}, 2}, `d1:xi1e1:yi2ee`, false},
+		{outerPtr{nil, 2}, `d1:yi2ee`, false},
+		{outerUnexported{embeddedInner{X: 1}, 2}, `d1:xi1e1:yi2ee`, false},
+		{embeddedPtr{&embeddedInner{X: 1}, 2}, `d1:xi1e1:yi2ee`, false},
+		{Node{&Node{V: 1}, 2}, `d1:vi2ee`, false},
+	}
+	testLoopMarshal(t, tcs)
+}
+
+func TestMarshalStructFieldTypes(t *testing.T) {
+	type name string
+	type count uint16
+	type flag bool
+	type blob []byte
+	type peer struct {
+		IP   string `bencode:"ip"`
+		Port uint16 `bencode:"port"`
+	}
+	type announce struct {
+		Interval int64            `bencode:"interval"`
+		Peers    []peer           `bencode:"peers"`
+		Name     name             `bencode:"name"`
+		Count    count            `bencode:"count"`
+		Flag     flag             `bencode:"flag"`
+		Blob     blob             `bencode:"blob"`
+		Raw      RawMessage       `bencode:"raw"`
+		Any      any              `bencode:"any"`
+		Nil      *peer            `bencode:"nil"`
+		Ptr      *peer            `bencode:"ptr"`
+		Map      map[string]int64 `bencode:"map,omitempty"`
+		Float    float32          `bencode:"float"`
+	}
+
+	tcs := []marshalTestCase{
+		{
+			announce{
+				Interval: 1800,
+				Peers:    []peer{{"1.2.3.4", 6881}},
+				Name:     "foo",
+				Count:    7,
+				Flag:     true,
+				Blob:     blob("bar"),
+				Raw:      RawMessage("i1e"),
+				Any:      "any",
+				Ptr:      &peer{"::1", 1},
+				Float:    10,
+			},
+			`d3:any3:any4:blob3:bar5:counti7e4:flagi1e5:floati1092616192e8:intervali1800e` +
+				`4:name3:foo5:peersld2:ip7:1.2.3.44:porti6881eee3:ptrd2:ip3:::14:porti1ee3:rawi1ee`,
+			false,
+		},
+		{name("x"), `1:x`, false},
+		{count(3), `i3e`, false},
+		{flag(false), `i0e`, false},
+		{[]name{"a", "b"}, `l1:a1:be`, false},
 	}
 	testLoopMarshal(t, tcs)
 }
@@ -232,6 +402,103 @@ func TestMarshalPointer(t *testing.T) {
 	testLoopMarshal(t, tcs)
 }
 
+func TestMarshalRawMessage(t *testing.T) {
+	type foo struct {
+		Info RawMessage  `bencode:"info"`
+		Ptr  *RawMessage `bencode:"ptr"`
+	}
+	raw := RawMessage(`li1ee`)
+
+	tcs := []marshalTestCase{
+		{RawMessage(`d1:ai1ee`), `d1:ai1ee`, false},
+		{foo{Info: RawMessage(`d1:ai1ee`), Ptr: &raw}, `d4:infod1:ai1ee3:ptrli1eee`, false},
+		{map[string]RawMessage{"x": RawMessage(`3:foo`)}, `d1:x3:fooe`, false},
+		{[]RawMessage{RawMessage(`i1e`), RawMessage(`0:`)}, `li1e0:e`, false},
+		{RawMessage(nil), ``, true},
+		{foo{Ptr: &raw}, ``, true},
+	}
+	testLoopMarshal(t, tcs)
+
+	for _, v := range []any{RawMessage(nil), &RawMessage{}} {
+		_, err := Marshal(v)
+		if want := "bencode: encode failed: cannot marshal empty RawMessage"; err == nil || err.Error() != want {
+			t.Fatalf("got %v want: %v", err, want)
+		}
+	}
+}
+
+func TestMarshalBigInt(t *testing.T) {
+	huge, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	type foo struct {
+		Big *big.Int `bencode:"big"`
+		Val big.Int  `bencode:"val"`
+	}
+
+	tcs := []marshalTestCase{
+		{huge, `i123456789012345678901234567890e`, false},
+		{new(big.Int).Neg(huge), `i-123456789012345678901234567890e`, false},
+		{big.NewInt(0), `i0e`, false},
+		{*big.NewInt(-7), `i-7e`, false},
+		{foo{huge, *big.NewInt(1)}, `d3:bigi123456789012345678901234567890e3:vali1ee`, false},
+		{(*big.Int)(nil), ``, true},
+	}
+	testLoopMarshal(t, tcs)
+
+	_, err := Marshal((*big.Int)(nil))
+	if want := "bencode: encode failed: cannot marshal nil *big.Int"; err == nil || err.Error() != want {
+		t.Fatalf("got %v want: %v", err, want)
+	}
+}
+
+func TestMarshalDictionary(t *testing.T) {
+	dict := D{{"c", 3}, {"a", 1}, {"b", 2}}
+	buf, err := Marshal(dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "d1:ai1e1:bi2e1:ci3ee"; string(buf) != want {
+		t.Fatalf("got %s want %s", buf, want)
+	}
+	if dict[0].K != "c" || dict[1].K != "a" || dict[2].K != "b" {
+		t.Fatalf("dict was modified: %v", dict)
+	}
+
+	large := make(D, 0, 50)
+	for i := 49; i >= 0; i-- {
+		large = append(large, struct {
+			K string
+			V any
+		}{string(rune('0' + i)), i})
+	}
+	buf, err = Marshal(large)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(buf), "d1:0i0e1:1i1e") || large[0].K != string(rune('0'+49)) {
+		t.Fatalf("got %s, dict %v", buf, large[:2])
+	}
+
+	tcs := []marshalTestCase{
+		{D{{"a", 1}, {"b", 2}, {"a", 3}}, ``, true},
+		{A{D{{"x", 1}, {"x", 1}}}, ``, true},
+	}
+	testLoopMarshal(t, tcs)
+}
+
+func TestEncoderPreserveOrder(t *testing.T) {
+	var sb strings.Builder
+	enc := NewEncoder(&sb)
+	enc.PreserveOrder()
+
+	dict := D{{"b", 1}, {"a", D{{"z", 1}, {"y", 2}}}, {"b", 3}}
+	if err := enc.Encode(dict); err != nil {
+		t.Fatal(err)
+	}
+	if want := "d1:bi1e1:ad1:zi1e1:yi2ee1:bi3ee"; sb.String() != want {
+		t.Fatalf("got %s want %s", sb.String(), want)
+	}
+}
+
 func testLoopMarshal(t *testing.T, tcs []marshalTestCase) {
 	t.Helper()
 
@@ -279,6 +546,35 @@ func Benchmark_Marshal(b *testing.B) {
 	}
 }
 
+func Benchmark_MarshalStruct(b *testing.B) {
+	type peer struct {
+		IP   string `bencode:"ip"`
+		Port uint16 `bencode:"port"`
+	}
+	type announce struct {
+		Complete   int64  `bencode:"complete"`
+		Incomplete int64  `bencode:"incomplete"`
+		Interval   int64  `bencode:"interval"`
+		Peers      []peer `bencode:"peers"`
+		Warning    string `bencode:"warning message,omitempty"`
+	}
+	resp := announce{
+		Complete:   10,
+		Incomplete: 3,
+		Interval:   1800,
+		Peers:      []peer{{"1.2.3.4", 6881}, {"5.6.7.8", 51413}},
+	}
+
+	dst := make([]byte, 0, 1<<12)
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		_, err := MarshalTo(dst, resp)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func Benchmark_MarshalTo(b *testing.B) {
 	dst := make([]byte, 0, 1<<12)
 	b.ReportAllocs()
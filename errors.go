@@ -0,0 +1,89 @@
+package bencode
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+)
+
+// Errors wrapped by SyntaxError, use errors.Is to check for them.
+// Truncated input is reported with io.ErrUnexpectedEOF.
+var (
+	ErrInvalidInteger = errors.New("bencode: invalid integer")
+	ErrInvalidString  = errors.New("bencode: invalid string")
+	ErrInvalidList    = errors.New("bencode: invalid list")
+	ErrInvalidDict    = errors.New("bencode: invalid dictionary")
+	ErrNonCanonical   = errors.New("bencode: non-canonical encoding")
+	ErrTrailingData   = errors.New("bencode: trailing data after top-level value")
+)
+
+// A SyntaxError is a description of a Bencode syntax error.
+type SyntaxError struct {
+	Offset int64  // error occurred after reading Offset bytes
+	Msg    string // description of error
+	err    error
+}
+
+func (e *SyntaxError) Error() string {
+	return "syntax error at offset " + strconv.FormatInt(e.Offset, 10) + ": " + e.Msg
+}
+
+func (e *SyntaxError) Unwrap() error { return e.err }
+
+// An UnmarshalTypeError describes a Bencode value that was
+// not appropriate for a value of a specific Go type.
+type UnmarshalTypeError struct {
+	Value  string       // description of Bencode value: "integer", "list", "integer 300"...
+	Type   reflect.Type // type of Go value it could not be assigned to
+	Offset int64        // error occurred after reading Offset bytes
+	Field  string       // path to the value from the root: "info.files[3].length"
+}
+
+func (e *UnmarshalTypeError) Error() string {
+	msg := "cannot decode " + e.Value + " into Go value of type " + e.Type.String()
+	if e.Field != "" {
+		msg += " for field " + strconv.Quote(e.Field)
+	}
+	return msg + " at offset " + strconv.FormatInt(e.Offset, 10)
+}
+
+// withKey prepends dictionary key to the path of UnmarshalTypeError.
+func withKey(err error, key []byte) error {
+	if e, ok := err.(*UnmarshalTypeError); ok {
+		switch {
+		case e.Field == "":
+			e.Field = string(key)
+		case e.Field[0] == '[':
+			e.Field = string(key) + e.Field
+		default:
+			e.Field = string(key) + "." + e.Field
+		}
+	}
+	return err
+}
+
+// withIndex prepends list index to the path of UnmarshalTypeError.
+func withIndex(err error, idx int) error {
+	if e, ok := err.(*UnmarshalTypeError); ok {
+		index := "[" + strconv.Itoa(idx) + "]"
+		switch {
+		case e.Field == "", e.Field[0] == '[':
+			e.Field = index + e.Field
+		default:
+			e.Field = index + "." + e.Field
+		}
+	}
+	return err
+}
+
+// A LimitExceededError is returned when the input violates decoder Limits.
+type LimitExceededError struct {
+	Limit  string // name of the limit: "depth", "input size", "string length", "elements"
+	Max    int64  // value of the limit
+	Offset int64  // error occurred after reading Offset bytes
+}
+
+func (e *LimitExceededError) Error() string {
+	return "limit exceeded: " + e.Limit + " is over " + strconv.FormatInt(e.Max, 10) +
+		" at offset " + strconv.FormatInt(e.Offset, 10)
+}
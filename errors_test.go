@@ -0,0 +1,117 @@
+package bencode
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSyntaxError(t *testing.T) {
+	tcs := []struct {
+		input  string
+		offset int64
+		err    error
+	}{
+		{`i12x4e`, 0, ErrInvalidInteger},
+		{`li1ei--2ee`, 4, ErrInvalidInteger},
+		{`l3:fooi1`, 8, io.ErrUnexpectedEOF},
+		{`d3:fooi1e`, 9, io.ErrUnexpectedEOF},
+		{`5:abc`, 5, io.ErrUnexpectedEOF},
+		{`l3:foo-1:e`, 6, ErrInvalidString},
+		{`lx`, 1, ErrInvalidString},
+		{`d3:fooi1ei2ei3ee`, 9, ErrInvalidDict},
+		{`d1:a`, 4, io.ErrUnexpectedEOF},
+	}
+
+	for i, test := range tcs {
+		for _, d := range []*Decoder{
+			NewDecodeBytes([]byte(test.input)),
+			NewDecoder(strings.NewReader(test.input)),
+		} {
+			var v any
+			err := d.Decode(&v)
+
+			var syntaxErr *SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("[test %d] want SyntaxError, got %v", i+1, err)
+			}
+			if syntaxErr.Offset != test.offset {
+				t.Fatalf("[test %d] got offset %d want: %d", i+1, syntaxErr.Offset, test.offset)
+			}
+			if !errors.Is(err, test.err) {
+				t.Fatalf("[test %d] got %v want: %v", i+1, err, test.err)
+			}
+		}
+	}
+}
+
+func TestUnmarshalTypeError(t *testing.T) {
+	type file struct {
+		Length uint32   `bencode:"length"`
+		Path   []string `bencode:"path"`
+	}
+	type info struct {
+		Files []file `bencode:"files"`
+	}
+	type torrent struct {
+		Info  info           `bencode:"info"`
+		Extra map[string]int `bencode:"extra"`
+	}
+
+	tcs := []struct {
+		input  string
+		field  string
+		offset int64
+		typ    reflect.Type
+	}{
+		{
+			`d4:infod5:filesld6:lengthi1eed6:lengthi-1eeeee`,
+			"info.files[1].length", 38, reflect.TypeOf(uint32(0)),
+		},
+		{
+			`d4:infod5:filesld4:pathl1:ai1eeeeee`,
+			"info.files[0].path[1]", 27, reflect.TypeOf(""),
+		},
+		{
+			`d5:extrad1:a3:fooee`,
+			"extra.a", 12, reflect.TypeOf(0),
+		},
+		{
+			`d4:infoli1eee`,
+			"info", 7, reflect.TypeOf(info{}),
+		},
+	}
+
+	for i, test := range tcs {
+		var v torrent
+		err := Unmarshal([]byte(test.input), &v)
+
+		var typeErr *UnmarshalTypeError
+		if !errors.As(err, &typeErr) {
+			t.Fatalf("[test %d] want UnmarshalTypeError, got %v", i+1, err)
+		}
+		if typeErr.Field != test.field {
+			t.Fatalf("[test %d] got field %q want: %q", i+1, typeErr.Field, test.field)
+		}
+		if typeErr.Offset != test.offset {
+			t.Fatalf("[test %d] got offset %d want: %d", i+1, typeErr.Offset, test.offset)
+		}
+		if typeErr.Type != test.typ {
+			t.Fatalf("[test %d] got type %v want: %v", i+1, typeErr.Type, test.typ)
+		}
+	}
+}
+
+func TestUnmarshalTypeErrorMessage(t *testing.T) {
+	var v struct {
+		N uint8 `bencode:"n"`
+	}
+	err := Unmarshal([]byte(`d1:ni300ee`), &v)
+
+	want := `bencode: decode failed: cannot decode integer 300 into Go value of type uint8 for field "n" at offset 4`
+	if err == nil || err.Error() != want {
+		t.Fatalf("got %v want: %v", err, want)
+	}
+}
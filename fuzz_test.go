@@ -0,0 +1,198 @@
+package bencode
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"testing/iotest"
+)
+
+// fuzzSeeds are real-world messages: torrent files, tracker responses
+// and DHT queries (BEP 5), plus some corner cases of the format.
+var fuzzSeeds = []string{
+	// DHT
+	`d1:ad2:id20:abcdefghij0123456789e1:q4:ping1:t2:aa1:y1:qe`,
+	`d1:rd2:id20:mnopqrstuvwxyz123456e1:t2:aa1:y1:re`,
+	`d1:ad2:id20:abcdefghij01234567896:target20:mnopqrstuvwxyz123456e1:q9:find_node1:t2:aa1:y1:qe`,
+	`d1:ad2:id20:abcdefghij01234567899:info_hash20:mnopqrstuvwxyz123456e1:q9:get_peers1:t2:aa1:y1:qe`,
+	`d1:rd2:id20:abcdefghij01234567895:token8:aoeusnth6:valuesl6:axje.u6:idhtnmee1:t2:aa1:y1:re`,
+	`d1:ad2:id20:abcdefghij012345678912:implied_porti1e9:info_hash20:mnopqrstuvwxyz1234564:porti6881e5:token8:aoeusnthe1:q13:announce_peer1:t2:aa1:y1:qe`,
+	`d1:eli201e23:A Generic Error Ocurrede1:t2:aa1:y1:ee`,
+	// tracker
+	`d8:completei5e10:incompletei2e8:intervali1800e12:min intervali900e5:peers12:abcdefghijkle`,
+	`d14:failure reason17:torrent not founde`,
+	// torrent
+	`d8:announce35:udp://tracker.openbittorrent.com:8013:announce-listll35:udp://tracker.openbittorrent.com:80el29:udp://tracker.publicbt.com:80ee7:comment12:Test torrent10:created by13:mktorrent 1.113:creation datei1500000000e4:infod6:lengthi170917888e4:name30:debian-8.8.0-arm64-netinst.iso12:piece lengthi262144e6:pieces20:aaaaaaaaaaaaaaaaaaaa7:privatei1eee`,
+	`d4:infod5:filesld6:lengthi10e4:pathl1:a5:b.txteed6:lengthi0e4:pathl1:cee4:name3:dir12:piece lengthi16384e6:pieces20:bbbbbbbbbbbbbbbbbbbbe8:url-listl19:http://example.com/ee`,
+	// corner cases
+	`i0e`, `i-0e`, `i03e`, `i+1e`, `i-9223372036854775808e`, `i18446744073709551616e`,
+	`0:`, `03:foo`, `le`, `de`, `lllleeee`, `d1:bi1e1:ai2e1:bi3ee`, `i1ei2e`, `d1:ai1e`,
+}
+
+func addSeeds(f *testing.F) {
+	for _, s := range fuzzSeeds {
+		f.Add([]byte(s))
+	}
+}
+
+func FuzzDecodeEncode(f *testing.F) {
+	addSeeds(f)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var v any
+		if err := Unmarshal(data, &v); err != nil {
+			return
+		}
+
+		buf, err := Marshal(v)
+		if err != nil {
+			t.Fatalf("cannot encode %#v: %v", v, err)
+		}
+
+		var v2 any
+		if err := Unmarshal(buf, &v2); err != nil {
+			t.Fatalf("cannot decode %q: %v", buf, err)
+		}
+		if !reflect.DeepEqual(v, v2) {
+			t.Fatalf("got %#v want %#v", v2, v)
+		}
+
+		// with D and A the order of keys and duplicates are kept
+		var dict any
+		d := NewDecodeBytes(data)
+		d.UseOrdered()
+		if err := d.Decode(&dict); err != nil {
+			t.Fatalf("cannot decode ordered: %v", err)
+		}
+
+		var ordered bytes.Buffer
+		enc := NewEncoder(&ordered)
+		enc.PreserveOrder()
+		if err := enc.Encode(dict); err != nil {
+			t.Fatalf("cannot encode %#v: %v", dict, err)
+		}
+
+		var dict2 any
+		d = NewDecodeBytes(ordered.Bytes())
+		d.UseOrdered()
+		if err := d.Decode(&dict2); err != nil {
+			t.Fatalf("cannot decode %q: %v", ordered.Bytes(), err)
+		}
+		if !reflect.DeepEqual(dict, dict2) {
+			t.Fatalf("got %#v want %#v", dict2, dict)
+		}
+	})
+}
+
+func FuzzCanonical(f *testing.F) {
+	addSeeds(f)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var v any
+		d := NewDecodeBytes(data)
+		d.DisallowNonCanonical()
+		if err := d.Decode(&v); err != nil || d.InputOffset() != int64(len(data)) {
+			return
+		}
+
+		buf, err := Marshal(v)
+		if err != nil {
+			t.Fatalf("cannot encode %#v: %v", v, err)
+		}
+		if !bytes.Equal(buf, data) {
+			t.Fatalf("canonical input %q encoded as %q", data, buf)
+		}
+	})
+}
+
+type fuzzTorrent struct {
+	Announce     string         `bencode:"announce"`
+	AnnounceList [][]string     `bencode:"announce-list,omitempty"`
+	Comment      *string        `bencode:"comment"`
+	CreationDate int64          `bencode:"creation date,omitempty"`
+	Info         fuzzInfo       `bencode:"info"`
+	InfoRaw      RawMessage     `bencode:"raw,omitempty"`
+	Nodes        [][2]any       `bencode:"nodes,omitempty"`
+	Extra        map[string]any `bencode:"extra,omitempty"`
+}
+
+type fuzzInfo struct {
+	Name        string     `bencode:"name"`
+	Length      uint64     `bencode:"length,omitempty"`
+	PieceLength int32      `bencode:"piece length"`
+	Pieces      []byte     `bencode:"pieces"`
+	Private     bool       `bencode:"private,omitempty"`
+	Files       []fuzzFile `bencode:"files,omitempty"`
+	Ratio       float64    `bencode:"ratio,omitempty"`
+}
+
+type fuzzFile struct {
+	Length int64    `bencode:"length"`
+	Path   []string `bencode:"path"`
+	MD5    [4]byte  `bencode:"md5sum"`
+}
+
+func FuzzStruct(f *testing.F) {
+	addSeeds(f)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var v fuzzTorrent
+		if err := Unmarshal(data, &v); err != nil {
+			return
+		}
+
+		buf, err := Marshal(v)
+		if err != nil {
+			t.Fatalf("cannot encode %#v: %v", v, err)
+		}
+
+		var v2 fuzzTorrent
+		if err := Unmarshal(buf, &v2); err != nil {
+			t.Fatalf("cannot decode %q: %v", buf, err)
+		}
+		buf2, err := Marshal(v2)
+		if err != nil {
+			t.Fatalf("cannot encode %#v: %v", v2, err)
+		}
+		if !bytes.Equal(buf, buf2) {
+			t.Fatalf("got %q want %q", buf2, buf)
+		}
+	})
+}
+
+func FuzzStream(f *testing.F) {
+	addSeeds(f)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if len(data) == 0 {
+			return
+		}
+
+		byBytes := NewDecodeBytes(data)
+		byStream := NewDecoder(iotest.OneByteReader(bytes.NewReader(data)))
+		for {
+			var want, got any
+			errWant := byBytes.Decode(&want)
+			errGot := byStream.Decode(&got)
+
+			if (errWant == nil) != (errGot == nil) {
+				t.Fatalf("bytes error %v, stream error %v", errWant, errGot)
+			}
+			if errors.Is(errWant, io.EOF) != errors.Is(errGot, io.EOF) {
+				t.Fatalf("bytes error %v, stream error %v", errWant, errGot)
+			}
+			if errWant != nil {
+				return
+			}
+
+			if !reflect.DeepEqual(want, got) {
+				t.Fatalf("got %#v want %#v", got, want)
+			}
+			if byBytes.InputOffset() != byStream.InputOffset() {
+				t.Fatalf("got offset %d want %d", byStream.InputOffset(), byBytes.InputOffset())
+			}
+		}
+	})
+}
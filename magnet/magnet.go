@@ -0,0 +1,282 @@
+// Package magnet implements magnet links for BitTorrent (BEP 9, BEP 53).
+package magnet
+
+import (
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cristalhq/bencode/metainfo"
+)
+
+const (
+	prefix = "magnet:?"
+
+	btihPrefix = "urn:btih:"
+	btmhPrefix = "urn:btmh:"
+
+	// multihashSHA256 is the multihash prefix of a SHA-256 hash:
+	// function code 0x12 and digest length 0x20.
+	multihashSHA256 = "1220"
+)
+
+// Magnet is a magnet link.
+type Magnet struct {
+	InfoHash    metainfo.Hash    // v1 info-hash, zero when absent
+	InfoHashV2  metainfo.Hash256 // v2 info-hash, zero when absent
+	DisplayName string
+	Trackers    []string
+	WebSeeds    []string
+	SelectOnly  []Range    // files to download (BEP 53), all files when empty
+	Params      url.Values // other parameters
+}
+
+// Range is an inclusive range of file indices.
+type Range struct {
+	Start, End int
+}
+
+// FromMetaInfo returns a magnet link of the torrent.
+func FromMetaInfo(mi *metainfo.MetaInfo) (Magnet, error) {
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return Magnet{}, err
+	}
+
+	m := Magnet{
+		DisplayName: info.Name,
+		WebSeeds:    mi.URLList,
+	}
+	if info.HasV1() {
+		m.InfoHash = mi.HashInfoBytes()
+	}
+	if info.HasV2() {
+		m.InfoHashV2 = mi.HashInfoBytesV2()
+	}
+	for _, tier := range mi.Trackers() {
+		m.Trackers = append(m.Trackers, tier...)
+	}
+	return m, nil
+}
+
+// HasV1 reports whether the link has a v1 info-hash.
+func (m Magnet) HasV1() bool {
+	return m.InfoHash != metainfo.Hash{}
+}
+
+// HasV2 reports whether the link has a v2 info-hash.
+func (m Magnet) HasV2() bool {
+	return m.InfoHashV2 != metainfo.Hash256{}
+}
+
+// String returns the magnet link.
+func (m Magnet) String() string {
+	var sb strings.Builder
+	sb.WriteString(prefix)
+
+	add := func(key, value string) {
+		if sb.Len() > len(prefix) {
+			sb.WriteByte('&')
+		}
+		sb.WriteString(key)
+		sb.WriteByte('=')
+		sb.WriteString(value)
+	}
+
+	if m.HasV1() {
+		add("xt", btihPrefix+m.InfoHash.HexString())
+	}
+	if m.HasV2() {
+		add("xt", btmhPrefix+multihashSHA256+m.InfoHashV2.HexString())
+	}
+	if m.DisplayName != "" {
+		add("dn", url.QueryEscape(m.DisplayName))
+	}
+	for _, tr := range m.Trackers {
+		add("tr", url.QueryEscape(tr))
+	}
+	for _, ws := range m.WebSeeds {
+		add("ws", url.QueryEscape(ws))
+	}
+	if len(m.SelectOnly) > 0 {
+		add("so", formatRanges(m.SelectOnly))
+	}
+
+	keys := make([]string, 0, len(m.Params))
+	for key := range m.Params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range m.Params[key] {
+			add(url.QueryEscape(key), url.QueryEscape(value))
+		}
+	}
+	return sb.String()
+}
+
+// Parse parses a magnet link.
+// At least one v1 or v2 info-hash is required.
+//
+// Numbered keys of BEP 9, like tr.1 or xt.2, are handled as keys without a number.
+// Parameters are split on '&' only, so values may contain unescaped ';'.
+func Parse(s string) (Magnet, error) {
+	if !strings.HasPrefix(s, prefix) {
+		return Magnet{}, errors.New("magnet: link must start with " + prefix)
+	}
+
+	var m Magnet
+	for _, param := range strings.Split(s[len(prefix):], "&") {
+		if param == "" {
+			continue
+		}
+		rawKey, rawValue, _ := strings.Cut(param, "=")
+		key, err := url.QueryUnescape(rawKey)
+		if err != nil {
+			return Magnet{}, fmt.Errorf("magnet: %w", err)
+		}
+		value, err := url.QueryUnescape(rawValue)
+		if err != nil {
+			return Magnet{}, fmt.Errorf("magnet: %w", err)
+		}
+
+		switch baseKey(key) {
+		case "xt":
+			if err := m.parseTopic(value); err != nil {
+				return Magnet{}, err
+			}
+		case "dn":
+			if m.DisplayName == "" {
+				m.DisplayName = value
+			}
+		case "tr":
+			m.Trackers = append(m.Trackers, value)
+		case "ws":
+			m.WebSeeds = append(m.WebSeeds, value)
+		case "so":
+			ranges, err := parseRanges(value)
+			if err != nil {
+				return Magnet{}, err
+			}
+			m.SelectOnly = append(m.SelectOnly, ranges...)
+		default:
+			if m.Params == nil {
+				m.Params = make(url.Values)
+			}
+			m.Params.Add(key, value)
+		}
+	}
+
+	if !m.HasV1() && !m.HasV2() {
+		return Magnet{}, errors.New("magnet: no info-hash")
+	}
+	return m, nil
+}
+
+// baseKey returns key without a number suffix, "tr.1" becomes "tr".
+func baseKey(key string) string {
+	base, num, ok := strings.Cut(key, ".")
+	if !ok || num == "" {
+		return key
+	}
+	for _, c := range num {
+		if c < '0' || c > '9' {
+			return key
+		}
+	}
+	return base
+}
+
+func (m *Magnet) parseTopic(xt string) error {
+	switch {
+	case strings.HasPrefix(xt, btihPrefix):
+		h, err := parseBTIH(xt[len(btihPrefix):])
+		if err != nil {
+			return err
+		}
+		m.InfoHash = h
+		return nil
+
+	case strings.HasPrefix(xt, btmhPrefix):
+		mh := xt[len(btmhPrefix):]
+		if !strings.HasPrefix(mh, multihashSHA256) || len(mh) != len(multihashSHA256)+2*metainfo.Hash256Size {
+			return errors.New("magnet: btmh must be a SHA-256 multihash")
+		}
+		if _, err := hex.Decode(m.InfoHashV2[:], []byte(mh[len(multihashSHA256):])); err != nil {
+			return fmt.Errorf("magnet: invalid btmh: %w", err)
+		}
+		return nil
+
+	default:
+		// other topics aren't BitTorrent info-hashes
+		return nil
+	}
+}
+
+// parseBTIH parses a v1 info-hash in the hex or base32 form.
+func parseBTIH(s string) (metainfo.Hash, error) {
+	var h metainfo.Hash
+	switch len(s) {
+	case 2 * metainfo.HashSize:
+		if _, err := hex.Decode(h[:], []byte(s)); err != nil {
+			return h, fmt.Errorf("magnet: invalid btih: %w", err)
+		}
+	case 32:
+		if _, err := base32.StdEncoding.Decode(h[:], []byte(strings.ToUpper(s))); err != nil {
+			return h, fmt.Errorf("magnet: invalid btih: %w", err)
+		}
+	default:
+		return h, errors.New("magnet: btih must be 40 hex or 32 base32 characters")
+	}
+	return h, nil
+}
+
+// parseRanges parses a list of ranges like "0,2,4-6".
+func parseRanges(s string) ([]Range, error) {
+	var ranges []Range
+	for _, part := range strings.Split(s, ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(from)
+		if err != nil || start < 0 {
+			return nil, errors.New("magnet: invalid so: " + s)
+		}
+		end := start
+		if isRange {
+			end, err = strconv.Atoi(to)
+			if err != nil || end < start {
+				return nil, errors.New("magnet: invalid so: " + s)
+			}
+		}
+		ranges = append(ranges, Range{Start: start, End: end})
+	}
+	return ranges, nil
+}
+
+func formatRanges(ranges []Range) string {
+	parts := make([]string, len(ranges))
+	for i, r := range ranges {
+		parts[i] = strconv.Itoa(r.Start)
+		if r.End != r.Start {
+			parts[i] += "-" + strconv.Itoa(r.End)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// Selected reports whether the file with index i is selected for download.
+func (m Magnet) Selected(i int) bool {
+	if len(m.SelectOnly) == 0 {
+		return true
+	}
+	for _, r := range m.SelectOnly {
+		if r.Start <= i && i <= r.End {
+			return true
+		}
+	}
+	return false
+}
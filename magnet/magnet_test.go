@@ -0,0 +1,176 @@
+package magnet
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cristalhq/bencode/metainfo"
+)
+
+func TestParse(t *testing.T) {
+	const link = "magnet:?xt=urn:btih:c12fe1c06bba254a9dc9f519b335aa7c1367a88a" +
+		"&xt=urn:btmh:1220caf1e1c30e81cb361b9ee167c4aa64228a7fa4fa9f6105232b28ad099f3a302e" +
+		"&dn=bittorrent-v2-test&tr=udp%3A%2F%2Ftracker.example.com%3A80&tr=http%3A%2F%2Fb%2Fannounce" +
+		"&ws=http%3A%2F%2Fexample.com%2Ffiles%2F&so=0,2,4-6&x.pe=1.2.3.4%3A6881"
+
+	m, err := Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.InfoHash.HexString() != "c12fe1c06bba254a9dc9f519b335aa7c1367a88a" {
+		t.Fatalf("got btih %s", m.InfoHash)
+	}
+	if m.InfoHashV2.HexString() != "caf1e1c30e81cb361b9ee167c4aa64228a7fa4fa9f6105232b28ad099f3a302e" {
+		t.Fatalf("got btmh %s", m.InfoHashV2)
+	}
+	if m.DisplayName != "bittorrent-v2-test" {
+		t.Fatalf("got dn %q", m.DisplayName)
+	}
+	if want := []string{"udp://tracker.example.com:80", "http://b/announce"}; !reflect.DeepEqual(m.Trackers, want) {
+		t.Fatalf("got tr %v", m.Trackers)
+	}
+	if want := []string{"http://example.com/files/"}; !reflect.DeepEqual(m.WebSeeds, want) {
+		t.Fatalf("got ws %v", m.WebSeeds)
+	}
+	if want := []Range{{0, 0}, {2, 2}, {4, 6}}; !reflect.DeepEqual(m.SelectOnly, want) {
+		t.Fatalf("got so %v", m.SelectOnly)
+	}
+	if want := (url.Values{"x.pe": {"1.2.3.4:6881"}}); !reflect.DeepEqual(m.Params, want) {
+		t.Fatalf("got params %v", m.Params)
+	}
+	for i, want := range []bool{true, false, true, false, true, true, true, false} {
+		if m.Selected(i) != want {
+			t.Fatalf("file %d: got %v", i, !want)
+		}
+	}
+
+	if got := m.String(); got != link {
+		t.Fatalf("got %s", got)
+	}
+}
+
+func TestParseBase32(t *testing.T) {
+	m, err := Parse("magnet:?xt=urn:btih:yex6dqdlxisuvhoj6um3gnnkpqjwpkek")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.InfoHash.HexString() != "c12fe1c06bba254a9dc9f519b335aa7c1367a88a" || m.HasV2() {
+		t.Fatalf("got %+v", m)
+	}
+	if !m.Selected(100) {
+		t.Fatal("want all files selected")
+	}
+}
+
+func TestParseSemicolonAndNumberedKeys(t *testing.T) {
+	const link = "magnet:?xt.1=urn:btih:c12fe1c06bba254a9dc9f519b335aa7c1367a88a" +
+		"&dn=a;b+c&tr.1=http://a/announce?x=1;y=2&tr.2=udp%3A%2F%2Fb%3A80&x.pe=1.2.3.4:6881&&"
+
+	m, err := Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.InfoHash.HexString() != "c12fe1c06bba254a9dc9f519b335aa7c1367a88a" {
+		t.Fatalf("got btih %s", m.InfoHash)
+	}
+	if m.DisplayName != "a;b c" {
+		t.Fatalf("got dn %q", m.DisplayName)
+	}
+	if want := []string{"http://a/announce?x=1;y=2", "udp://b:80"}; !reflect.DeepEqual(m.Trackers, want) {
+		t.Fatalf("got tr %v", m.Trackers)
+	}
+	if want := (url.Values{"x.pe": {"1.2.3.4:6881"}}); !reflect.DeepEqual(m.Params, want) {
+		t.Fatalf("got params %v", m.Params)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, link := range []string{
+		"http://example.com",
+		"magnet:?dn=foo",
+		"magnet:?xt=urn:sha1:abc",
+		"magnet:?xt=urn:btih:abc",
+		"magnet:?xt=urn:btih:zz2fe1c06bba254a9dc9f519b335aa7c1367a88a",
+		"magnet:?xt=urn:btih:11111111111111111111111111111111",
+		"magnet:?xt=urn:btmh:1114c12fe1c06bba254a9dc9f519b335aa7c1367a88a",
+		"magnet:?xt=urn:btih:c12fe1c06bba254a9dc9f519b335aa7c1367a88a&so=1-a",
+		"magnet:?xt=urn:btih:c12fe1c06bba254a9dc9f519b335aa7c1367a88a&so=3-1",
+		"magnet:?xt=urn:btih:c12fe1c06bba254a9dc9f519b335aa7c1367a88a&dn=%zz",
+	} {
+		if _, err := Parse(link); err == nil {
+			t.Fatalf("want error for %q", link)
+		}
+	}
+}
+
+func TestFromMetaInfo(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "my file.iso")
+	if err := os.WriteFile(path, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	b := &metainfo.Builder{
+		AnnounceList: [][]string{{"http://a/announce"}, {"http://b/announce", "udp://c:80"}},
+		URLList:      metainfo.URLList{"http://example.com/"},
+	}
+	mi, err := b.Build(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := FromMetaInfo(mi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.InfoHash != mi.HashInfoBytes() || m.HasV2() || m.DisplayName != "my file.iso" {
+		t.Fatalf("got %+v", m)
+	}
+	if len(m.Trackers) != 3 || len(m.WebSeeds) != 1 {
+		t.Fatalf("got %+v", m)
+	}
+
+	link := m.String()
+	if !strings.HasPrefix(link, "magnet:?xt=urn:btih:"+mi.HashInfoBytes().HexString()+"&dn=my+file.iso&tr=") {
+		t.Fatalf("got %s", link)
+	}
+	m2, err := Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, m2) {
+		t.Fatalf("got %+v want %+v", m2, m)
+	}
+
+	// v2 info-hash is added for v2 torrents
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, _, err := metainfo.HashFileV2(strings.NewReader("hello"), info.PieceLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info.MetaVersion = 2
+	info.FileTree = &metainfo.FileTree{Dir: map[string]metainfo.FileTree{
+		info.Name: {File: &metainfo.FileTreeFile{Length: 5, PiecesRoot: root[:]}},
+	}}
+	if err := mi.SetInfo(&info); err != nil {
+		t.Fatal(err)
+	}
+	m, err = FromMetaInfo(mi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.HasV1() || m.InfoHashV2 != mi.HashInfoBytesV2() {
+		t.Fatalf("got %+v", m)
+	}
+	if !strings.Contains(m.String(), "&xt=urn:btmh:1220"+mi.HashInfoBytesV2().HexString()) {
+		t.Fatalf("got %s", m.String())
+	}
+}
@@ -0,0 +1,377 @@
+package metainfo
+
+import (
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	minPieceLength = 16 << 10
+	maxPieceLength = 16 << 20
+
+	// targetPieces is the number of pieces Builder aims for
+	// when the piece length isn't set.
+	targetPieces = 1500
+)
+
+// Builder creates a torrent from a file or a directory on disk.
+//
+// Zero value is ready to use, the fields are copied into the torrent.
+type Builder struct {
+	Announce     string
+	AnnounceList [][]string
+	URLList      URLList
+	Comment      string
+	CreatedBy    string
+	CreationDate time.Time // not set when zero
+
+	Name        string // base name of the path when empty
+	PieceLength int64  // chosen by the total size when zero
+	Private     bool
+	Source      string
+
+	// PadFiles inserts padding files (BEP 47), so each file starts at a piece boundary.
+	PadFiles bool
+
+	// Workers is the number of goroutines hashing pieces,
+	// runtime.GOMAXPROCS(0) is used when zero.
+	Workers int
+
+	// Progress is called after each hashed piece with the number of hashed
+	// and total bytes. It's called from different goroutines, but never concurrently.
+	Progress func(hashed, total int64)
+}
+
+// Build walks path, hashes the content and returns the torrent.
+// A file gives a single-file torrent, a directory gives a multi-file torrent
+// with files in the order of their paths. Only regular files are included.
+// Content of zero size cannot be shared, so empty files alone are an error.
+//
+// Build stops and returns ctx.Err() when ctx is canceled.
+func (b *Builder) Build(ctx context.Context, path string) (*MetaInfo, error) {
+	files, isDir, err := collectFiles(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &Info{
+		Name:        b.Name,
+		PieceLength: b.PieceLength,
+		Private:     b.Private,
+		Source:      b.Source,
+	}
+	if info.Name == "" {
+		info.Name = filepath.Base(filepath.Clean(path))
+	}
+
+	var total int64
+	for _, f := range files {
+		total += f.Length
+	}
+	if total == 0 {
+		return nil, errors.New("metainfo: no content to share, all files are empty")
+	}
+	if info.PieceLength == 0 {
+		info.PieceLength = choosePieceLength(total)
+	}
+	if info.PieceLength <= 0 {
+		return nil, errors.New("metainfo: piece length must be positive")
+	}
+
+	if isDir {
+		if b.PadFiles {
+			files = padFiles(files, info.PieceLength)
+		}
+		for _, f := range files {
+			info.Files = append(info.Files, f.File)
+		}
+	} else {
+		info.Length = files[0].Length
+	}
+
+	r := &filesReader{files: files}
+	info.Pieces, err = hashPieces(ctx, r, info.TotalLength(), info.PieceLength, b.Workers, b.Progress)
+	if err != nil {
+		return nil, err
+	}
+
+	mi := &MetaInfo{
+		Announce:     b.Announce,
+		AnnounceList: b.AnnounceList,
+		URLList:      b.URLList,
+		Comment:      b.Comment,
+		CreatedBy:    b.CreatedBy,
+	}
+	if !b.CreationDate.IsZero() {
+		mi.CreationDate = b.CreationDate.Unix()
+	}
+	if err := mi.SetInfo(info); err != nil {
+		return nil, err
+	}
+	return mi, nil
+}
+
+// diskFile is a file of the torrent and its location on disk.
+// Padding files have no location.
+type diskFile struct {
+	File
+	osPath string
+}
+
+func collectFiles(root string) (files []diskFile, isDir bool, err error) {
+	fi, err := os.Stat(root)
+	if err != nil {
+		return nil, false, err
+	}
+	if !fi.IsDir() {
+		if !fi.Mode().IsRegular() {
+			return nil, false, fmt.Errorf("metainfo: %s is not a regular file", root)
+		}
+		return []diskFile{{File: File{Length: fi.Size()}, osPath: root}}, false, nil
+	}
+
+	// WalkDir visits entries in lexical order, so files are sorted by path
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, diskFile{
+			File:   File{Length: fi.Size(), Path: strings.Split(filepath.ToSlash(rel), "/")},
+			osPath: path,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if len(files) == 0 {
+		return nil, false, fmt.Errorf("metainfo: no files in %s", root)
+	}
+	return files, true, nil
+}
+
+// choosePieceLength returns a power of two between 16 KiB and 16 MiB
+// giving about targetPieces pieces.
+func choosePieceLength(total int64) int64 {
+	n := int64(minPieceLength)
+	for n < maxPieceLength && total/n > targetPieces {
+		n *= 2
+	}
+	return n
+}
+
+// padFiles inserts a padding file after each file not ending at a piece boundary.
+// The last file is never padded.
+func padFiles(files []diskFile, pieceLength int64) []diskFile {
+	res := make([]diskFile, 0, 2*len(files))
+	var offset int64
+	for i, f := range files {
+		res = append(res, f)
+		offset += f.Length
+
+		if rem := offset % pieceLength; rem != 0 && i < len(files)-1 {
+			n := pieceLength - rem
+			res = append(res, diskFile{File: File{
+				Length: n,
+				Path:   []string{".pad", strconv.FormatInt(n, 10)},
+				Attr:   "p",
+			}})
+			offset += n
+		}
+	}
+	return res
+}
+
+// hashPieces reads files one piece at a time and hashes pieces in parallel.
+func hashPieces(ctx context.Context, r *filesReader, total, pieceLength int64, workers int, progress func(hashed, total int64)) ([]byte, error) {
+	numPieces := (total + pieceLength - 1) / pieceLength
+	pieces := make([]byte, numPieces*HashSize)
+
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type job struct {
+		index int64
+		data  []byte
+	}
+	jobs := make(chan job)
+	free := make(chan []byte, workers+1)
+
+	var mu sync.Mutex
+	var hashed int64
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				h := sha1.Sum(j.data)
+				copy(pieces[j.index*HashSize:], h[:])
+				free <- j.data[:cap(j.data)]
+
+				if progress != nil {
+					mu.Lock()
+					hashed += int64(len(j.data))
+					progress(hashed, total)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	err := readPieces(ctx, r, pieceLength, workers+1, free, func(index int64, data []byte) error {
+		select {
+		case jobs <- job{index: index, data: data}:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	close(jobs)
+	wg.Wait()
+
+	if err != nil {
+		return nil, err
+	}
+	return pieces, nil
+}
+
+// readPieces reads r in pieces into buffers from free, at most maxBuffers are allocated.
+func readPieces(ctx context.Context, r *filesReader, pieceLength int64, maxBuffers int, free chan []byte, fn func(index int64, data []byte) error) error {
+	defer r.Close()
+
+	allocated := 0
+	for index := int64(0); ; index++ {
+		var buf []byte
+		select {
+		case buf = <-free:
+		default:
+			if allocated < maxBuffers {
+				buf = make([]byte, pieceLength)
+				allocated++
+				break
+			}
+			select {
+			case buf = <-free:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			if err := fn(index, buf[:n]); err != nil {
+				return err
+			}
+		}
+		switch {
+		case err == io.EOF || err == io.ErrUnexpectedEOF:
+			return nil
+		case err != nil:
+			return err
+		}
+	}
+}
+
+// filesReader reads files one after another, padding files are read as zeros.
+// With zeroFill missing and truncated files are read as zeros too.
+type filesReader struct {
+	files    []diskFile
+	cur      *os.File
+	left     int64 // bytes left in the current file
+	zeroFill bool
+}
+
+func (r *filesReader) Read(p []byte) (int, error) {
+	for r.left == 0 {
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+
+	if int64(len(p)) > r.left {
+		p = p[:r.left]
+	}
+	if r.cur == nil {
+		for i := range p {
+			p[i] = 0
+		}
+		r.left -= int64(len(p))
+		return len(p), nil
+	}
+
+	n, err := r.cur.Read(p)
+	r.left -= int64(n)
+	if err == io.EOF {
+		if r.left > 0 && r.zeroFill {
+			return n, r.Close()
+		}
+		if r.left > 0 {
+			return n, fmt.Errorf("metainfo: file %s was truncated", r.cur.Name())
+		}
+		err = nil
+	}
+	return n, err
+}
+
+func (r *filesReader) next() error {
+	if err := r.Close(); err != nil {
+		return err
+	}
+	if len(r.files) == 0 {
+		return io.EOF
+	}
+
+	f := r.files[0]
+	r.files = r.files[1:]
+	r.left = f.Length
+	if f.osPath == "" {
+		return nil
+	}
+
+	file, err := os.Open(f.osPath)
+	if err != nil {
+		if r.zeroFill && errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	r.cur = file
+	return nil
+}
+
+func (r *filesReader) Close() error {
+	if r.cur == nil {
+		return nil
+	}
+	err := r.cur.Close()
+	r.cur = nil
+	return err
+}
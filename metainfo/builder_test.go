@@ -0,0 +1,229 @@
+package metainfo
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func hashAll(data []byte, pieceLength int) []byte {
+	var pieces []byte
+	for i := 0; i < len(data); i += pieceLength {
+		end := i + pieceLength
+		if end > len(data) {
+			end = len(data)
+		}
+		h := sha1.Sum(data[i:end])
+		pieces = append(pieces, h[:]...)
+	}
+	return pieces
+}
+
+func TestBuilderDir(t *testing.T) {
+	a := string(bytes.Repeat([]byte("a"), 50000))
+	c := string(bytes.Repeat([]byte("c"), 20000))
+	dir := writeFiles(t, map[string]string{
+		"a.txt":       a,
+		"sub/b.txt":   "bbb",
+		"sub/c/d.txt": c,
+		"empty":       "",
+	})
+
+	var calls int
+	var last int64
+	b := &Builder{
+		Announce:     "http://tracker",
+		CreatedBy:    "test",
+		CreationDate: time.Unix(1500000000, 0),
+		Name:         "data",
+		PieceLength:  minPieceLength,
+		Private:      true,
+		Workers:      4,
+		Progress: func(hashed, total int64) {
+			calls++
+			last = hashed
+			if total != 70003 {
+				t.Errorf("got total %d", total)
+			}
+		},
+	}
+	mi, err := b.Build(context.Background(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mi.Announce != "http://tracker" || mi.CreationDate != 1500000000 {
+		t.Fatalf("got %+v", mi)
+	}
+	if calls != 5 || last != 70003 {
+		t.Fatalf("got %d calls, %d bytes", calls, last)
+	}
+
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := info.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	wantFiles := []File{
+		{Length: 50000, Path: []string{"a.txt"}},
+		{Length: 0, Path: []string{"empty"}},
+		{Length: 3, Path: []string{"sub", "b.txt"}},
+		{Length: 20000, Path: []string{"sub", "c", "d.txt"}},
+	}
+	if !reflect.DeepEqual(info.Files, wantFiles) {
+		t.Fatalf("got %+v", info.Files)
+	}
+	if info.Name != "data" || !info.Private {
+		t.Fatalf("got %+v", info)
+	}
+	if want := hashAll([]byte(a+"bbb"+c), minPieceLength); !bytes.Equal(info.Pieces, want) {
+		t.Fatal("wrong pieces")
+	}
+
+	// result doesn't depend on the number of workers
+	b.Workers = 1
+	b.Progress = nil
+	mi2, err := b.Build(context.Background(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(mi.InfoBytes, mi2.InfoBytes) {
+		t.Fatal("different info with 1 worker")
+	}
+}
+
+func TestBuilderPadFiles(t *testing.T) {
+	a := string(bytes.Repeat([]byte("a"), 20000))
+	dir := writeFiles(t, map[string]string{
+		"a": a,
+		"b": "bbb",
+		"c": "ccc",
+	})
+
+	b := &Builder{PieceLength: minPieceLength, PadFiles: true}
+	mi, err := b.Build(context.Background(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := info.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	pad1 := int64(2*minPieceLength - 20000)
+	pad2 := int64(minPieceLength - 3)
+	wantFiles := []File{
+		{Length: 20000, Path: []string{"a"}},
+		{Length: pad1, Path: []string{".pad", "12768"}, Attr: "p"},
+		{Length: 3, Path: []string{"b"}},
+		{Length: pad2, Path: []string{".pad", "16381"}, Attr: "p"},
+		{Length: 3, Path: []string{"c"}},
+	}
+	if !reflect.DeepEqual(info.Files, wantFiles) {
+		t.Fatalf("got %+v", info.Files)
+	}
+	if !info.Files[1].IsPadFile() || info.Files[2].IsPadFile() {
+		t.Fatal("wrong pad files")
+	}
+
+	data := a + string(make([]byte, pad1)) + "bbb" + string(make([]byte, pad2)) + "ccc"
+	if want := hashAll([]byte(data), minPieceLength); !bytes.Equal(info.Pieces, want) {
+		t.Fatal("wrong pieces")
+	}
+}
+
+func TestBuilderSingleFile(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"file.iso": "hello"})
+
+	var b Builder
+	mi, err := b.Build(context.Background(), filepath.Join(dir, "file.iso"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "file.iso" || info.Length != 5 || info.IsDir() || info.PieceLength != minPieceLength {
+		t.Fatalf("got %+v", info)
+	}
+	if want := hashAll([]byte("hello"), minPieceLength); !bytes.Equal(info.Pieces, want) {
+		t.Fatal("wrong pieces")
+	}
+
+	var buf bytes.Buffer
+	if err := mi.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBuilderErrors(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"a": "aaa"})
+	var b Builder
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := b.Build(ctx, dir); !errors.Is(err, context.Canceled) {
+		t.Fatalf("want context.Canceled, got %v", err)
+	}
+
+	if _, err := b.Build(context.Background(), t.TempDir()); err == nil {
+		t.Fatal("want error for empty dir")
+	}
+	if _, err := b.Build(context.Background(), filepath.Join(dir, "missing")); err == nil {
+		t.Fatal("want error for missing file")
+	}
+
+	empty := writeFiles(t, map[string]string{"a": "", "sub/b": ""})
+	for _, path := range []string{empty, filepath.Join(empty, "a")} {
+		if _, err := b.Build(context.Background(), path); err == nil {
+			t.Fatalf("want error for empty content of %s", path)
+		}
+	}
+}
+
+func TestChoosePieceLength(t *testing.T) {
+	tcs := []struct {
+		total int64
+		want  int64
+	}{
+		{0, minPieceLength},
+		{1 << 20, minPieceLength},
+		{700 << 20, 512 << 10},
+		{1 << 50, maxPieceLength},
+	}
+	for _, tc := range tcs {
+		if got := choosePieceLength(tc.total); got != tc.want {
+			t.Fatalf("total %d: got %d want %d", tc.total, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package metainfo
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/cristalhq/bencode"
+)
+
+// FileTree is a node of the BitTorrent v2 file tree (BEP 52).
+// A file is a node with File set, it's encoded under the empty key.
+// A directory is a node with Dir set.
+type FileTree struct {
+	File *FileTreeFile
+	Dir  map[string]FileTree
+}
+
+// FileTreeFile is a file in the file tree.
+type FileTreeFile struct {
+	Length     int64  `bencode:"length"`
+	PiecesRoot []byte `bencode:"pieces root,omitempty"` // empty for empty files
+}
+
+// MarshalBencode implements bencode.Marshaler.
+func (ft FileTree) MarshalBencode() ([]byte, error) {
+	m := make(map[string]any, len(ft.Dir)+1)
+	for name, node := range ft.Dir {
+		if name == "" {
+			return nil, errors.New("metainfo: empty file name in file tree")
+		}
+		m[name] = node
+	}
+	if ft.File != nil {
+		m[""] = ft.File
+	}
+	return bencode.Marshal(m)
+}
+
+// maxFileTreeDepth is the maximum number of path components in a file tree.
+// It's much more than real paths have, but limits work on crafted input.
+const maxFileTreeDepth = 512
+
+// UnmarshalBencode implements bencode.Unmarshaler.
+func (ft *FileTree) UnmarshalBencode(b []byte) error {
+	d := bencode.NewDecodeBytes(b)
+	// a file adds 2 dictionaries: the node with the empty key and the file itself
+	d.SetLimits(bencode.Limits{MaxDepth: maxFileTreeDepth + 2})
+
+	var m map[string]any
+	if err := d.Decode(&m); err != nil {
+		return err
+	}
+	return ft.fromMap(m)
+}
+
+// fromMap builds the tree from a decoded dictionary,
+// so the input is parsed once whatever the depth is.
+func (ft *FileTree) fromMap(m map[string]any) error {
+	*ft = FileTree{}
+	for name, value := range m {
+		dict, ok := value.(map[string]any)
+		if !ok {
+			return errors.New("metainfo: file tree node is not a dictionary")
+		}
+
+		if name == "" {
+			f, err := fileTreeFile(dict)
+			if err != nil {
+				return err
+			}
+			ft.File = f
+			continue
+		}
+
+		var node FileTree
+		if err := node.fromMap(dict); err != nil {
+			return err
+		}
+		if ft.Dir == nil {
+			ft.Dir = make(map[string]FileTree, len(m))
+		}
+		ft.Dir[name] = node
+	}
+	return nil
+}
+
+func fileTreeFile(m map[string]any) (*FileTreeFile, error) {
+	length, ok := m["length"].(int64)
+	if !ok {
+		return nil, errors.New("metainfo: file length is not an integer")
+	}
+	f := &FileTreeFile{Length: length}
+
+	if root, ok := m["pieces root"]; ok {
+		if f.PiecesRoot, ok = root.([]byte); !ok {
+			return nil, errors.New("metainfo: pieces root is not a string")
+		}
+	}
+	return f, nil
+}
+
+// FileV2 is a file of a BitTorrent v2 torrent.
+type FileV2 struct {
+	Path       []string
+	Length     int64
+	PiecesRoot Hash256
+}
+
+// Walk calls fn for each file in the tree in the order of paths.
+// Nil tree has no files.
+func (ft *FileTree) Walk(fn func(path []string, f *FileTreeFile) error) error {
+	if ft == nil {
+		return nil
+	}
+	return ft.walk(nil, fn)
+}
+
+func (ft *FileTree) walk(path []string, fn func(path []string, f *FileTreeFile) error) error {
+	if ft.File != nil {
+		if err := fn(path, ft.File); err != nil {
+			return err
+		}
+	}
+
+	names := make([]string, 0, len(ft.Dir))
+	for name := range ft.Dir {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		node := ft.Dir[name]
+		if err := node.walk(append(path[:len(path):len(path)], name), fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package metainfo
+
+import (
+	"encoding/hex"
+	"errors"
+)
+
+// HashSize is the size of SHA-1 hash.
+const HashSize = 20
+
+// Hash is a SHA-1 hash, used as a v1 info-hash and as a piece hash.
+type Hash [HashSize]byte
+
+// HexString returns the hash in the hex form.
+func (h Hash) HexString() string {
+	return hex.EncodeToString(h[:])
+}
+
+// String implements fmt.Stringer.
+func (h Hash) String() string {
+	return h.HexString()
+}
+
+// ParseHash parses a hash in the hex form.
+func ParseHash(s string) (Hash, error) {
+	var h Hash
+	if hex.DecodedLen(len(s)) != HashSize {
+		return h, errors.New("metainfo: hash must be 40 hex characters")
+	}
+	_, err := hex.Decode(h[:], []byte(s))
+	return h, err
+}
+
+// Hash256Size is the size of SHA-256 hash.
+const Hash256Size = 32
+
+// Hash256 is a SHA-256 hash, used as a v2 info-hash (BEP 52) and in merkle trees.
+type Hash256 [Hash256Size]byte
+
+// HexString returns the hash in the hex form.
+func (h Hash256) HexString() string {
+	return hex.EncodeToString(h[:])
+}
+
+// String implements fmt.Stringer.
+func (h Hash256) String() string {
+	return h.HexString()
+}
+
+// Truncate returns the first 20 bytes of the hash,
+// they are used instead of a v2 info-hash where a v1 info-hash is expected.
+func (h Hash256) Truncate() Hash {
+	var t Hash
+	copy(t[:], h[:])
+	return t
+}
@@ -0,0 +1,259 @@
+package metainfo
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Info is the info dictionary of a torrent.
+//
+// In the single-file mode Length is set and Files is empty,
+// in the multi-file mode Name is a directory and Files lists its content.
+//
+// BitTorrent v2 torrents (BEP 52) have MetaVersion 2 and FileTree set,
+// hybrid torrents have both v1 and v2 fields.
+type Info struct {
+	Name        string    `bencode:"name"`
+	PieceLength int64     `bencode:"piece length"`
+	Pieces      []byte    `bencode:"pieces,omitempty"`
+	Private     bool      `bencode:"private,omitempty"`
+	Length      int64     `bencode:"length,omitempty"`
+	Files       []File    `bencode:"files,omitempty"`
+	Source      string    `bencode:"source,omitempty"`
+	MetaVersion int64     `bencode:"meta version,omitempty"`
+	FileTree    *FileTree `bencode:"file tree,omitempty"`
+}
+
+// File is a file in the multi-file mode.
+type File struct {
+	Length int64    `bencode:"length"`
+	Path   []string `bencode:"path"`
+	Attr   string   `bencode:"attr,omitempty"` // BEP 47
+}
+
+// IsPadFile reports whether the file is a padding file (BEP 47),
+// its content is zeros and it isn't stored on disk.
+func (f File) IsPadFile() bool {
+	return strings.Contains(f.Attr, "p")
+}
+
+// DisplayPath returns the file path joined with slashes.
+func (f File) DisplayPath() string {
+	return strings.Join(f.Path, "/")
+}
+
+// HasV1 reports whether the torrent has v1 fields.
+func (info *Info) HasV1() bool {
+	return info.MetaVersion != 2 || len(info.Pieces) != 0
+}
+
+// HasV2 reports whether the torrent has v2 fields.
+func (info *Info) HasV2() bool {
+	return info.MetaVersion == 2
+}
+
+// IsHybrid reports whether the torrent is both v1 and v2.
+func (info *Info) IsHybrid() bool {
+	return info.HasV1() && info.HasV2()
+}
+
+// FilesV2 returns the files of the v2 file tree in the order of paths.
+func (info *Info) FilesV2() []FileV2 {
+	var files []FileV2
+	_ = info.FileTree.Walk(func(path []string, f *FileTreeFile) error {
+		file := FileV2{Path: path, Length: f.Length}
+		copy(file.PiecesRoot[:], f.PiecesRoot)
+		files = append(files, file)
+		return nil
+	})
+	return files
+}
+
+// IsDir reports whether the torrent is in the multi-file mode.
+func (info *Info) IsDir() bool {
+	return len(info.Files) != 0
+}
+
+// TotalLength returns the total size of the torrent content.
+func (info *Info) TotalLength() int64 {
+	if !info.IsDir() {
+		return info.Length
+	}
+	var n int64
+	for _, f := range info.Files {
+		n += f.Length
+	}
+	return n
+}
+
+// UpvertedFiles returns the files of the torrent,
+// a single-file torrent is returned as one file without a path.
+func (info *Info) UpvertedFiles() []File {
+	if !info.IsDir() {
+		return []File{{Length: info.Length}}
+	}
+	return info.Files
+}
+
+// NumPieces returns the number of pieces.
+func (info *Info) NumPieces() int {
+	return len(info.Pieces) / HashSize
+}
+
+// Piece returns the SHA-1 hash of the i-th piece.
+func (info *Info) Piece(i int) Hash {
+	var h Hash
+	copy(h[:], info.Pieces[i*HashSize:])
+	return h
+}
+
+// Validate checks that required fields are set and consistent.
+func (info *Info) Validate() error {
+	switch {
+	case info.Name == "":
+		return errors.New("metainfo: name is empty")
+	case !isValidPathComponent(info.Name):
+		return errors.New("metainfo: invalid name " + strconv.Quote(info.Name))
+	case info.PieceLength <= 0:
+		return errors.New("metainfo: piece length must be positive")
+	}
+
+	if info.HasV1() {
+		if err := info.validateV1(); err != nil {
+			return err
+		}
+	}
+	if info.HasV2() {
+		if err := info.validateV2(); err != nil {
+			return err
+		}
+	}
+	if info.IsHybrid() {
+		return info.validateHybrid()
+	}
+	return nil
+}
+
+func (info *Info) validateV1() error {
+	switch {
+	case len(info.Pieces)%HashSize != 0:
+		return errors.New("metainfo: pieces length is not a multiple of 20")
+	case info.Length != 0 && len(info.Files) != 0:
+		return errors.New("metainfo: both length and files are set")
+	}
+
+	total := info.TotalLength()
+	if want := (total + info.PieceLength - 1) / info.PieceLength; int64(info.NumPieces()) != want {
+		return errors.New("metainfo: number of pieces does not match total length")
+	}
+	for _, f := range info.Files {
+		if f.Length < 0 || !isValidPath(f.Path) {
+			return errors.New("metainfo: invalid file " + strconv.Quote(f.DisplayPath()))
+		}
+	}
+	return nil
+}
+
+// validateHybrid checks that v1 files and the v2 file tree describe the same content:
+// the same files in the same order, each non-empty one aligned to a piece with BEP 47 padding files.
+func (info *Info) validateHybrid() error {
+	filesV2 := info.FilesV2()
+	files := info.UpvertedFiles()
+	var offset int64
+	n := 0
+	for i, f := range files {
+		path := f.Path
+		if !info.IsDir() {
+			path = []string{info.Name}
+		}
+
+		if f.IsPadFile() {
+			rem := offset % info.PieceLength
+			if i == 0 || files[i-1].IsPadFile() || rem == 0 || f.Length != info.PieceLength-rem {
+				return errors.New("metainfo: invalid padding file " + strconv.Quote(f.DisplayPath()))
+			}
+			offset += f.Length
+			continue
+		}
+
+		switch {
+		case f.Length > 0 && offset%info.PieceLength != 0:
+			return errors.New("metainfo: file " + strconv.Quote(f.DisplayPath()) + " is not aligned to a piece")
+		case n == len(filesV2) || f.Length != filesV2[n].Length || !equalPaths(path, filesV2[n].Path):
+			return errors.New("metainfo: file " + strconv.Quote(f.DisplayPath()) + " does not match file tree")
+		}
+		n++
+		offset += f.Length
+	}
+	if n != len(filesV2) {
+		return errors.New("metainfo: file tree has more files than v1 files")
+	}
+	return nil
+}
+
+func equalPaths(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// isValidPath reports whether path is not empty and all its components are valid.
+func isValidPath(path []string) bool {
+	if len(path) == 0 {
+		return false
+	}
+	for _, s := range path {
+		if !isValidPathComponent(s) {
+			return false
+		}
+	}
+	return true
+}
+
+// isValidPathComponent reports whether s can be used as a file name
+// inside the download directory: it's not empty, "." or "..",
+// and has no path separators or a volume name.
+func isValidPathComponent(s string) bool {
+	switch s {
+	case "", ".", "..":
+		return false
+	}
+	return !strings.ContainsAny(s, "/\\\x00") && !filepath.IsAbs(s) && filepath.VolumeName(s) == ""
+}
+
+func (info *Info) validateV2() error {
+	if !isValidPieceLengthV2(info.PieceLength) {
+		return errors.New("metainfo: piece length must be a power of two and at least 16 KiB")
+	}
+
+	n := 0
+	err := info.FileTree.Walk(func(path []string, f *FileTreeFile) error {
+		n++
+		switch {
+		case len(path) == 0:
+			return errors.New("metainfo: file without a name in file tree")
+		case !isValidPath(path):
+			return errors.New("metainfo: invalid file " + strconv.Quote(strings.Join(path, "/")))
+		case f.Length < 0:
+			return errors.New("metainfo: invalid file " + strings.Join(path, "/"))
+		case f.Length > 0 && len(f.PiecesRoot) != Hash256Size:
+			return errors.New("metainfo: invalid pieces root of " + strings.Join(path, "/"))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New("metainfo: file tree is empty")
+	}
+	return nil
+}
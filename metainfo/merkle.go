@@ -0,0 +1,124 @@
+package metainfo
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io"
+)
+
+// BlockSize is the size of a merkle tree leaf in BitTorrent v2 (BEP 52).
+const BlockSize = 16 << 10
+
+// HashFileV2 computes the merkle tree of a file read from r as described in BEP 52.
+// It returns the root of the tree, the pieces root of the file,
+// and the piece layer, which is set only for files larger than pieceLength.
+// The root is zero for an empty file.
+func HashFileV2(r io.Reader, pieceLength int64) (root Hash256, layer []byte, err error) {
+	if !isValidPieceLengthV2(pieceLength) {
+		return root, nil, errors.New("metainfo: piece length must be a power of two and at least 16 KiB")
+	}
+
+	var leaves []Hash256
+	buf := make([]byte, BlockSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			leaves = append(leaves, sha256.Sum256(buf[:n]))
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return root, nil, err
+		}
+	}
+
+	if len(leaves) == 0 {
+		return root, nil, nil
+	}
+
+	perPiece := int(pieceLength / BlockSize)
+	if len(leaves) <= perPiece {
+		return merkleRoot(leaves, Hash256{}), nil, nil
+	}
+
+	pieces := make([]Hash256, 0, (len(leaves)+perPiece-1)/perPiece)
+	for i := 0; i < len(leaves); i += perPiece {
+		end := i + perPiece
+		if end > len(leaves) {
+			end = len(leaves)
+		}
+		pieces = append(pieces, merkleRootN(leaves[i:end], Hash256{}, perPiece))
+	}
+
+	layer = make([]byte, 0, len(pieces)*Hash256Size)
+	for _, h := range pieces {
+		layer = append(layer, h[:]...)
+	}
+	return merkleRoot(pieces, padHash(pieceLength)), layer, nil
+}
+
+// RootFromPieceLayer computes the pieces root of a file from its piece layer.
+func RootFromPieceLayer(layer []byte, pieceLength int64) (Hash256, error) {
+	if len(layer) == 0 || len(layer)%Hash256Size != 0 {
+		return Hash256{}, errors.New("metainfo: piece layer length is not a multiple of 32")
+	}
+	if !isValidPieceLengthV2(pieceLength) {
+		return Hash256{}, errors.New("metainfo: piece length must be a power of two and at least 16 KiB")
+	}
+
+	pieces := make([]Hash256, len(layer)/Hash256Size)
+	for i := range pieces {
+		copy(pieces[i][:], layer[i*Hash256Size:])
+	}
+	return merkleRoot(pieces, padHash(pieceLength)), nil
+}
+
+// padHash returns the root of a piece full of zero leaves,
+// it's used to pad a piece layer to a power of two.
+func padHash(pieceLength int64) Hash256 {
+	h := Hash256{}
+	for n := pieceLength / BlockSize; n > 1; n /= 2 {
+		h = hashPair(h, h)
+	}
+	return h
+}
+
+// merkleRoot computes the root of a tree with hashes as leaves,
+// the number of leaves is padded with pad to the next power of two.
+func merkleRoot(hashes []Hash256, pad Hash256) Hash256 {
+	return merkleRootN(hashes, pad, len(hashes))
+}
+
+// merkleRootN is like merkleRoot but pads to at least n leaves.
+func merkleRootN(hashes []Hash256, pad Hash256, n int) Hash256 {
+	width := 1
+	for width < n || width < len(hashes) {
+		width *= 2
+	}
+
+	layer := make([]Hash256, width)
+	copy(layer, hashes)
+	for i := len(hashes); i < width; i++ {
+		layer[i] = pad
+	}
+
+	for len(layer) > 1 {
+		for i := 0; i < len(layer)/2; i++ {
+			layer[i] = hashPair(layer[2*i], layer[2*i+1])
+		}
+		layer = layer[:len(layer)/2]
+	}
+	return layer[0]
+}
+
+func hashPair(a, b Hash256) Hash256 {
+	var buf [2 * Hash256Size]byte
+	copy(buf[:], a[:])
+	copy(buf[Hash256Size:], b[:])
+	return sha256.Sum256(buf[:])
+}
+
+func isValidPieceLengthV2(n int64) bool {
+	return n >= BlockSize && n&(n-1) == 0
+}
@@ -0,0 +1,66 @@
+package metainfo
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+)
+
+func TestHashFileV2(t *testing.T) {
+	blocks := make([][]byte, 5)
+	leaves := make([]Hash256, 5)
+	var data []byte
+	for i := range blocks {
+		blocks[i] = bytes.Repeat([]byte{byte('a' + i)}, BlockSize)
+		if i == 4 {
+			blocks[i] = blocks[i][:100]
+		}
+		leaves[i] = sha256.Sum256(blocks[i])
+		data = append(data, blocks[i]...)
+	}
+	var zero Hash256
+	h := hashPair
+
+	root, layer, err := HashFileV2(bytes.NewReader(blocks[0]), BlockSize)
+	if err != nil || root != leaves[0] || layer != nil {
+		t.Fatalf("got %v %x %v", root, layer, err)
+	}
+
+	// file is smaller than a piece, leaves are padded with zeros
+	root, layer, err = HashFileV2(bytes.NewReader(data[:3*BlockSize]), 4*BlockSize)
+	if err != nil || root != h(h(leaves[0], leaves[1]), h(leaves[2], zero)) || layer != nil {
+		t.Fatalf("got %v %x %v", root, layer, err)
+	}
+
+	// piece layer is padded with hashes of zero pieces
+	root, layer, err = HashFileV2(bytes.NewReader(data), 2*BlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p0, p1, p2 := h(leaves[0], leaves[1]), h(leaves[2], leaves[3]), h(leaves[4], zero)
+	if want := h(h(p0, p1), h(p2, h(zero, zero))); root != want {
+		t.Fatalf("got root %v want %v", root, want)
+	}
+	if want := append(append(p0[:], p1[:]...), p2[:]...); !bytes.Equal(layer, want) {
+		t.Fatalf("got layer %x want %x", layer, want)
+	}
+
+	got, err := RootFromPieceLayer(layer, 2*BlockSize)
+	if err != nil || got != root {
+		t.Fatalf("got %v %v", got, err)
+	}
+
+	root, layer, err = HashFileV2(bytes.NewReader(nil), BlockSize)
+	if err != nil || root != zero || layer != nil {
+		t.Fatalf("got %v %x %v", root, layer, err)
+	}
+
+	for _, pieceLength := range []int64{0, BlockSize / 2, 3 * BlockSize} {
+		if _, _, err := HashFileV2(bytes.NewReader(data), pieceLength); err == nil {
+			t.Fatalf("want error for piece length %d", pieceLength)
+		}
+	}
+	if _, err := RootFromPieceLayer(make([]byte, 33), 2*BlockSize); err == nil {
+		t.Fatal("want error")
+	}
+}
@@ -0,0 +1,184 @@
+// Package metainfo implements the .torrent file format (BEP 3).
+package metainfo
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cristalhq/bencode"
+)
+
+// MetaInfo is the content of a .torrent file.
+//
+// The info dictionary is kept as raw bytes, so the info-hash
+// is computed over the exact bytes of the file, even if they are not canonical.
+type MetaInfo struct {
+	InfoBytes    bencode.RawMessage `bencode:"info"`
+	Announce     string             `bencode:"announce,omitempty"`
+	AnnounceList [][]string         `bencode:"announce-list,omitempty"` // BEP 12
+	URLList      URLList            `bencode:"url-list,omitempty"`      // BEP 19
+	CreationDate int64              `bencode:"creation date,omitempty"`
+	Comment      string             `bencode:"comment,omitempty"`
+	CreatedBy    string             `bencode:"created by,omitempty"`
+	Encoding     string             `bencode:"encoding,omitempty"`
+
+	// PieceLayers maps pieces root of a file to the concatenated
+	// hashes of its pieces, it's set for v2 torrents only (BEP 52).
+	PieceLayers map[Hash256][]byte `bencode:"piece layers,omitempty"`
+}
+
+// Load decodes a MetaInfo from r.
+func Load(r io.Reader) (*MetaInfo, error) {
+	var mi MetaInfo
+	d := bencode.NewDecoder(r)
+	d.CopyBytes()
+	if err := d.Decode(&mi); err != nil {
+		return nil, err
+	}
+	switch {
+	case len(mi.InfoBytes) == 0:
+		return nil, errors.New("metainfo: missing info dictionary")
+	case mi.InfoBytes[0] != 'd':
+		return nil, errors.New("metainfo: info is not a dictionary")
+	}
+	return &mi, nil
+}
+
+// LoadFromFile decodes a MetaInfo from the file at path.
+func LoadFromFile(path string) (*MetaInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
+
+// Write encodes mi to w.
+func (mi *MetaInfo) Write(w io.Writer) error {
+	return bencode.NewEncoder(w).Encode(mi)
+}
+
+// UnmarshalInfo decodes the info dictionary.
+func (mi *MetaInfo) UnmarshalInfo() (Info, error) {
+	var info Info
+	err := bencode.Unmarshal(mi.InfoBytes, &info)
+	return info, err
+}
+
+// SetInfo encodes info and sets it as the info dictionary.
+func (mi *MetaInfo) SetInfo(info *Info) error {
+	b, err := bencode.Marshal(info)
+	if err != nil {
+		return err
+	}
+	mi.InfoBytes = b
+	return nil
+}
+
+// HashInfoBytes returns the v1 info-hash, SHA-1 of the info dictionary.
+func (mi *MetaInfo) HashInfoBytes() Hash {
+	return sha1.Sum(mi.InfoBytes)
+}
+
+// HashInfoBytesV2 returns the v2 info-hash, SHA-256 of the info dictionary.
+func (mi *MetaInfo) HashInfoBytesV2() Hash256 {
+	return sha256.Sum256(mi.InfoBytes)
+}
+
+// VerifyPieceLayers checks that piece layers hash up to the pieces roots
+// of files larger than a piece, and there are no other piece layers.
+func (mi *MetaInfo) VerifyPieceLayers(info *Info) error {
+	if !info.HasV2() {
+		return errors.New("metainfo: not a v2 torrent")
+	}
+
+	used := 0
+	for _, f := range info.FilesV2() {
+		if f.Length <= info.PieceLength {
+			continue
+		}
+
+		layer, ok := mi.PieceLayers[f.PiecesRoot]
+		if !ok {
+			return fmt.Errorf("metainfo: missing piece layer for %s", strings.Join(f.Path, "/"))
+		}
+		numPieces := (f.Length + info.PieceLength - 1) / info.PieceLength
+		if int64(len(layer)) != numPieces*Hash256Size {
+			return fmt.Errorf("metainfo: piece layer for %s has wrong length", strings.Join(f.Path, "/"))
+		}
+
+		root, err := RootFromPieceLayer(layer, info.PieceLength)
+		if err != nil {
+			return err
+		}
+		if root != f.PiecesRoot {
+			return fmt.Errorf("metainfo: piece layer for %s does not match pieces root", strings.Join(f.Path, "/"))
+		}
+		used++
+	}
+
+	if used != len(mi.PieceLayers) {
+		return errors.New("metainfo: piece layers contain unknown roots")
+	}
+	return nil
+}
+
+// Trackers returns announce URLs grouped in tiers as described in BEP 12.
+// The announce key is used when there is no announce-list.
+func (mi *MetaInfo) Trackers() [][]string {
+	if len(mi.AnnounceList) > 0 {
+		return mi.AnnounceList
+	}
+	if mi.Announce != "" {
+		return [][]string{{mi.Announce}}
+	}
+	return nil
+}
+
+// CreationTime returns the creation date as time.Time,
+// it's zero when the date isn't set.
+func (mi *MetaInfo) CreationTime() time.Time {
+	if mi.CreationDate == 0 {
+		return time.Time{}
+	}
+	return time.Unix(mi.CreationDate, 0)
+}
+
+// URLList is a list of web seeds (BEP 19).
+// It's encoded as a list, but a single string is also accepted.
+type URLList []string
+
+// MarshalBencode implements bencode.Marshaler.
+func (l URLList) MarshalBencode() ([]byte, error) {
+	return bencode.Marshal([]string(l))
+}
+
+// UnmarshalBencode implements bencode.Unmarshaler.
+func (l *URLList) UnmarshalBencode(b []byte) error {
+	if bytes.HasPrefix(b, []byte("l")) {
+		var list []string
+		if err := bencode.Unmarshal(b, &list); err != nil {
+			return err
+		}
+		*l = list
+		return nil
+	}
+
+	var s string
+	if err := bencode.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	*l = nil
+	if s != "" {
+		*l = URLList{s}
+	}
+	return nil
+}
@@ -0,0 +1,367 @@
+package metainfo
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const (
+	singleInfo = `d6:lengthi40000e4:name8:file.iso12:piece lengthi32768e6:pieces40:aaaaaaaaaaaaaaaaaaaabbbbbbbbbbbbbbbbbbbb7:privatei1ee`
+	singleFile = `d8:announce20:http://tracker/a.php13:announce-listll20:http://tracker/a.phpel13:udp://t2:1337ee7:comment4:test13:creation datei1500000000e4:info` + singleInfo + `8:url-list19:http://example.com/e`
+
+	// keys of the info are not sorted
+	multiInfo = `d4:name3:dir5:filesld6:lengthi10e4:pathl1:a5:b.txteed6:lengthi5e4:pathl1:ceee12:piece lengthi16384e6:pieces20:cccccccccccccccccccce`
+	multiFile = `d4:info` + multiInfo + `8:url-listl10:http://a/s10:http://b/see`
+)
+
+func TestLoadSingleFile(t *testing.T) {
+	mi, err := Load(strings.NewReader(singleFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(mi.InfoBytes) != singleInfo {
+		t.Fatalf("got info %s", mi.InfoBytes)
+	}
+	if mi.HashInfoBytes() != sha1.Sum([]byte(singleInfo)) {
+		t.Fatalf("got hash %s", mi.HashInfoBytes())
+	}
+	wantTrackers := [][]string{{"http://tracker/a.php"}, {"udp://t2:1337"}}
+	if !reflect.DeepEqual(mi.Trackers(), wantTrackers) {
+		t.Fatalf("got trackers %v", mi.Trackers())
+	}
+	if !reflect.DeepEqual(mi.URLList, URLList{"http://example.com/"}) {
+		t.Fatalf("got url-list %v", mi.URLList)
+	}
+	if mi.Comment != "test" || mi.CreationTime().Unix() != 1500000000 {
+		t.Fatalf("got %+v", mi)
+	}
+
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := info.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if info.IsDir() || info.TotalLength() != 40000 || !info.Private || info.NumPieces() != 2 {
+		t.Fatalf("got %+v", info)
+	}
+	if info.Piece(1).HexString() != strings.Repeat("62", 20) {
+		t.Fatalf("got piece %s", info.Piece(1))
+	}
+	if files := info.UpvertedFiles(); len(files) != 1 || files[0].Length != 40000 {
+		t.Fatalf("got %v", files)
+	}
+
+	var buf bytes.Buffer
+	if err := mi.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	// url-list is always written as a list
+	if want := strings.Replace(singleFile, "19:http://example.com/", "l19:http://example.com/e", 1); buf.String() != want {
+		t.Fatalf("got %s", buf.String())
+	}
+}
+
+func TestLoadMultiFile(t *testing.T) {
+	mi, err := Load(strings.NewReader(multiFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mi.HashInfoBytes() != sha1.Sum([]byte(multiInfo)) {
+		t.Fatalf("got hash %s", mi.HashInfoBytes())
+	}
+	if len(mi.URLList) != 2 || mi.Trackers() != nil {
+		t.Fatalf("got %+v", mi)
+	}
+
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := info.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if !info.IsDir() || info.TotalLength() != 15 || info.Files[0].DisplayPath() != "a/b.txt" {
+		t.Fatalf("got %+v", info)
+	}
+
+	// raw info bytes are written as is, so the hash doesn't change
+	var buf bytes.Buffer
+	if err := mi.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	mi2, err := Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mi2.HashInfoBytes() != mi.HashInfoBytes() {
+		t.Fatal("info-hash changed")
+	}
+
+	if err := mi.SetInfo(&info); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(mi.InfoBytes), "d5:filesl") {
+		t.Fatalf("want canonical info, got %s", mi.InfoBytes)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	for _, input := range []string{``, `de`, `d8:announce1:xe`, `d4:infoi1ee`, `d4:infod4:name1:ae8:url-listi1ee`} {
+		if _, err := Load(strings.NewReader(input)); err == nil {
+			t.Fatalf("want error for %q", input)
+		}
+	}
+}
+
+func TestInfoValidate(t *testing.T) {
+	pieces := make([]byte, 2*HashSize)
+	tcs := []Info{
+		{PieceLength: 10, Pieces: pieces, Length: 20},
+		{Name: "a", Pieces: pieces, Length: 20},
+		{Name: "a", PieceLength: 10, Pieces: pieces[:5], Length: 20},
+		{Name: "a", PieceLength: 10, Pieces: pieces, Length: 21},
+		{Name: "a", PieceLength: 10, Pieces: pieces, Length: 20, Files: []File{{Length: 1, Path: []string{"a"}}}},
+		{Name: "a", PieceLength: 10, Pieces: pieces, Files: []File{{Length: 20}}},
+		{Name: "..", PieceLength: 10, Pieces: pieces, Length: 20},
+		{Name: "a/b", PieceLength: 10, Pieces: pieces, Length: 20},
+		{Name: "/a", PieceLength: 10, Pieces: pieces, Length: 20},
+		{Name: "a", PieceLength: 10, Pieces: pieces, Files: []File{{Length: 20, Path: []string{"..", "..", "secret"}}}},
+		{Name: "a", PieceLength: 10, Pieces: pieces, Files: []File{{Length: 20, Path: []string{"b", ""}}}},
+		{Name: "a", PieceLength: 10, Pieces: pieces, Files: []File{{Length: 20, Path: []string{"."}}}},
+		{Name: "a", PieceLength: 10, Pieces: pieces, Files: []File{{Length: 20, Path: []string{"b/../../c"}}}},
+		{Name: "a", PieceLength: 10, Pieces: pieces, Files: []File{{Length: 20, Path: []string{`b\c`}}}},
+		{Name: "a", PieceLength: 10, Pieces: pieces, Files: []File{{Length: 20, Path: []string{"/etc"}}}},
+	}
+	for i, info := range tcs {
+		if err := info.Validate(); err == nil {
+			t.Fatalf("[test %d] want error", i+1)
+		}
+	}
+}
+
+func TestParseHash(t *testing.T) {
+	h := sha1.Sum([]byte("x"))
+	got, err := ParseHash(Hash(h).HexString())
+	if err != nil || got != h {
+		t.Fatalf("got %v %v", got, err)
+	}
+	if _, err := ParseHash("abc"); err == nil {
+		t.Fatal("want error")
+	}
+}
+
+func TestMetaInfoV2(t *testing.T) {
+	const pieceLength = 2 * BlockSize
+	big := bytes.Repeat([]byte("0123456789"), 10000)
+	small := []byte("hello")
+
+	bigRoot, bigLayer, err := HashFileV2(bytes.NewReader(big), pieceLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+	smallRoot, smallLayer, err := HashFileV2(bytes.NewReader(small), pieceLength)
+	if err != nil || smallLayer != nil {
+		t.Fatal(err)
+	}
+
+	info := &Info{
+		Name:        "dir",
+		PieceLength: pieceLength,
+		MetaVersion: 2,
+		FileTree: &FileTree{Dir: map[string]FileTree{
+			"big.bin": {File: &FileTreeFile{Length: int64(len(big)), PiecesRoot: bigRoot[:]}},
+			"sub": {Dir: map[string]FileTree{
+				"empty": {File: &FileTreeFile{Length: 0}},
+				"small": {File: &FileTreeFile{Length: int64(len(small)), PiecesRoot: smallRoot[:]}},
+			}},
+		}},
+	}
+	mi := &MetaInfo{
+		Announce:    "http://tracker",
+		PieceLayers: map[Hash256][]byte{bigRoot: bigLayer},
+	}
+	if err := mi.SetInfo(info); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(mi.InfoBytes), "9:file treed7:big.bind0:d6:lengthi100000e11:pieces root32:") {
+		t.Fatalf("got %s", mi.InfoBytes)
+	}
+
+	var buf bytes.Buffer
+	if err := mi.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	mi2, err := Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mi2.HashInfoBytesV2() != sha256.Sum256(mi.InfoBytes) {
+		t.Fatalf("got hash %s", mi2.HashInfoBytesV2())
+	}
+	if h, truncated := mi2.HashInfoBytesV2(), mi2.HashInfoBytesV2().Truncate(); !bytes.Equal(truncated[:], h[:20]) {
+		t.Fatalf("got truncated %s", h.Truncate())
+	}
+
+	info2, err := mi2.UnmarshalInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := info2.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if !info2.HasV2() || info2.HasV1() || info2.IsHybrid() {
+		t.Fatalf("got %+v", info2)
+	}
+	if !reflect.DeepEqual(info2.FileTree, info.FileTree) {
+		t.Fatalf("got %+v want %+v", info2.FileTree, info.FileTree)
+	}
+
+	files := info2.FilesV2()
+	wantFiles := []FileV2{
+		{Path: []string{"big.bin"}, Length: int64(len(big)), PiecesRoot: bigRoot},
+		{Path: []string{"sub", "empty"}},
+		{Path: []string{"sub", "small"}, Length: int64(len(small)), PiecesRoot: smallRoot},
+	}
+	if !reflect.DeepEqual(files, wantFiles) {
+		t.Fatalf("got %+v", files)
+	}
+
+	if err := mi2.VerifyPieceLayers(&info2); err != nil {
+		t.Fatal(err)
+	}
+
+	mi2.PieceLayers[bigRoot][0] ^= 1
+	if err := mi2.VerifyPieceLayers(&info2); err == nil {
+		t.Fatal("want error for corrupted layer")
+	}
+	mi2.PieceLayers[bigRoot] = bigLayer[:32]
+	if err := mi2.VerifyPieceLayers(&info2); err == nil {
+		t.Fatal("want error for short layer")
+	}
+	mi2.PieceLayers = map[Hash256][]byte{bigRoot: bigLayer, smallRoot: smallRoot[:]}
+	if err := mi2.VerifyPieceLayers(&info2); err == nil {
+		t.Fatal("want error for unknown layer")
+	}
+	mi2.PieceLayers = nil
+	if err := mi2.VerifyPieceLayers(&info2); err == nil {
+		t.Fatal("want error for missing layer")
+	}
+
+	// hybrid torrent has v1 fields too, files are aligned to pieces with padding
+	pad := pieceLength - int64(len(big))%pieceLength
+	info.Pieces = make([]byte, 5*HashSize)
+	info.Files = []File{
+		{Length: int64(len(big)), Path: []string{"big.bin"}},
+		{Length: pad, Path: []string{".pad", strconv.FormatInt(pad, 10)}, Attr: "p"},
+		{Length: 0, Path: []string{"sub", "empty"}},
+		{Length: int64(len(small)), Path: []string{"sub", "small"}},
+	}
+	if err := info.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if !info.IsHybrid() {
+		t.Fatal("want hybrid")
+	}
+
+	hybrid := info.Files
+	tcs := [][]File{
+		{hybrid[0], hybrid[2], hybrid[3]},
+		{hybrid[0], hybrid[1], hybrid[3]},
+		{hybrid[0], hybrid[1], hybrid[3], hybrid[2]},
+		{hybrid[0], hybrid[1], hybrid[2], {Length: int64(len(small)), Path: []string{"sub", "other"}}},
+		{hybrid[0], hybrid[1], hybrid[2], {Length: 4, Path: []string{"sub", "small"}}},
+		{hybrid[0], hybrid[1], hybrid[1], hybrid[2], hybrid[3]},
+		{hybrid[0], {Length: pad - 1, Path: []string{".pad", "x"}, Attr: "p"}, hybrid[2], hybrid[3]},
+	}
+	for i, files := range tcs {
+		info.Files = files
+		var total int64
+		for _, f := range files {
+			total += f.Length
+		}
+		info.Pieces = make([]byte, (total+pieceLength-1)/pieceLength*HashSize)
+		if err := info.Validate(); err == nil {
+			t.Fatalf("[test %d] want error for mismatched hybrid files", i+1)
+		}
+	}
+
+	single := &Info{
+		Name:        "small",
+		PieceLength: pieceLength,
+		MetaVersion: 2,
+		Length:      int64(len(small)),
+		Pieces:      make([]byte, HashSize),
+		FileTree: &FileTree{Dir: map[string]FileTree{
+			"small": {File: &FileTreeFile{Length: int64(len(small)), PiecesRoot: smallRoot[:]}},
+		}},
+	}
+	if err := single.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	single.Name = "other"
+	if err := single.Validate(); err == nil {
+		t.Fatal("want error for mismatched name")
+	}
+}
+
+func TestFileTreeErrors(t *testing.T) {
+	var ft FileTree
+	for _, input := range []string{`le`, `d1:ai1ee`, `d0:i1ee`, `d0:de`, `d0:d6:length1:1ee`, `d0:d6:lengthi1e11:pieces rooti1eee`} {
+		if err := ft.UnmarshalBencode([]byte(input)); err == nil {
+			t.Fatalf("want error for %q", input)
+		}
+	}
+
+	info := Info{Name: "a", PieceLength: BlockSize, MetaVersion: 2}
+	tcs := []*FileTree{
+		nil,
+		{File: &FileTreeFile{Length: 1}},
+		{Dir: map[string]FileTree{"a": {File: &FileTreeFile{Length: 1, PiecesRoot: []byte("short")}}}},
+		{Dir: map[string]FileTree{"..": {Dir: map[string]FileTree{"secret": {File: &FileTreeFile{Length: 0}}}}}},
+		{Dir: map[string]FileTree{"a/b": {File: &FileTreeFile{Length: 0}}}},
+		{Dir: map[string]FileTree{".": {File: &FileTreeFile{Length: 0}}}},
+	}
+	for i, ft := range tcs {
+		info.FileTree = ft
+		if err := info.Validate(); err == nil {
+			t.Fatalf("[test %d] want error", i+1)
+		}
+	}
+}
+
+func TestFileTreeDepth(t *testing.T) {
+	nested := func(depth int) []byte {
+		var sb strings.Builder
+		for i := 0; i < depth; i++ {
+			sb.WriteString("d1:a")
+		}
+		sb.WriteString("d0:d6:lengthi1eee")
+		for i := 0; i < depth; i++ {
+			sb.WriteString("e")
+		}
+		return []byte(sb.String())
+	}
+
+	var ft FileTree
+	if err := ft.UnmarshalBencode(nested(maxFileTreeDepth)); err != nil {
+		t.Fatal(err)
+	}
+	files := (&Info{FileTree: &ft}).FilesV2()
+	if len(files) != 1 || len(files[0].Path) != maxFileTreeDepth || files[0].Length != 1 {
+		t.Fatalf("got %d files", len(files))
+	}
+
+	if err := ft.UnmarshalBencode(nested(maxFileTreeDepth + 1)); err == nil {
+		t.Fatal("want error for too deep tree")
+	}
+	if err := ft.UnmarshalBencode(nested(9990)); err == nil {
+		t.Fatal("want error for too deep tree")
+	}
+}
@@ -0,0 +1,160 @@
+package metainfo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+// Bitfield is a set of pieces, the highest bit of the first byte is piece 0.
+// It has the same layout as the bitfield message of the peer protocol.
+type Bitfield []byte
+
+// NewBitfield returns an empty bitfield for n pieces.
+func NewBitfield(n int) Bitfield {
+	return make(Bitfield, (n+7)/8)
+}
+
+// Has reports whether the piece i is in the set.
+func (bf Bitfield) Has(i int) bool {
+	return bf[i/8]&(0x80>>(i%8)) != 0
+}
+
+// Set adds the piece i to the set.
+func (bf Bitfield) Set(i int) {
+	bf[i/8] |= 0x80 >> (i % 8)
+}
+
+// Count returns the number of pieces in the set.
+func (bf Bitfield) Count() int {
+	n := 0
+	for _, b := range bf {
+		n += bits.OnesCount8(b)
+	}
+	return n
+}
+
+// VerifyResult is the result of a local data check.
+type VerifyResult struct {
+	Pieces    Bitfield // valid pieces
+	NumPieces int
+	Missing   []string // files which don't exist or aren't regular files
+	Short     []string // files smaller than in the torrent
+}
+
+// Complete reports whether all pieces are valid.
+func (r *VerifyResult) Complete() bool {
+	return r.Pieces.Count() == r.NumPieces
+}
+
+// Verifier checks downloaded data against the v1 piece hashes of a torrent.
+//
+// Zero value is ready to use.
+type Verifier struct {
+	// Workers and Progress have the same meaning as in Builder.
+	Workers  int
+	Progress func(hashed, total int64)
+}
+
+// Verify hashes the content of the torrent stored in dir and reports valid pieces.
+// The content is expected at dir/info.Name, padding files aren't read from disk.
+// Missing and short files are reported in the result,
+// pieces overlapping absent data are never valid.
+//
+// Verify stops and returns ctx.Err() when ctx is canceled.
+func (v *Verifier) Verify(ctx context.Context, info *Info, dir string) (*VerifyResult, error) {
+	if !info.HasV1() || info.PieceLength <= 0 || len(info.Pieces)%HashSize != 0 {
+		return nil, errors.New("metainfo: torrent has no v1 pieces")
+	}
+
+	// names come from the torrent, they must not point outside of dir
+	if !isValidPathComponent(info.Name) {
+		return nil, errors.New("metainfo: invalid name " + strconv.Quote(info.Name))
+	}
+	root := filepath.Join(dir, info.Name)
+	res := &VerifyResult{
+		Pieces:    NewBitfield(info.NumPieces()),
+		NumPieces: info.NumPieces(),
+	}
+
+	// byte ranges of absent data, sorted by offset
+	var absent [][2]int64
+	var files []diskFile
+	var offset int64
+	for _, f := range info.UpvertedFiles() {
+		df := diskFile{File: f}
+		if !f.IsPadFile() {
+			df.osPath = root
+			if info.IsDir() {
+				if !isValidPath(f.Path) {
+					return nil, errors.New("metainfo: invalid file " + strconv.Quote(f.DisplayPath()))
+				}
+				df.osPath = filepath.Join(append([]string{root}, f.Path...)...)
+			}
+
+			size, ok, err := fileSize(df.osPath)
+			switch {
+			case err != nil:
+				return nil, err
+			case !ok:
+				res.Missing = append(res.Missing, df.osPath)
+				df.osPath = "" // read as zeros
+			case size < f.Length:
+				res.Short = append(res.Short, df.osPath)
+			}
+			if size < f.Length {
+				absent = append(absent, [2]int64{offset + size, offset + f.Length})
+			}
+		}
+		files = append(files, df)
+		offset += f.Length
+	}
+
+	total := info.TotalLength()
+	if want := (total + info.PieceLength - 1) / info.PieceLength; int64(res.NumPieces) != want {
+		return nil, errors.New("metainfo: number of pieces does not match total length")
+	}
+
+	r := &filesReader{files: files, zeroFill: true}
+	hashes, err := hashPieces(ctx, r, total, info.PieceLength, v.Workers, v.Progress)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < res.NumPieces; i++ {
+		start := int64(i) * info.PieceLength
+		end := start + info.PieceLength
+		for len(absent) > 0 && absent[0][1] <= start {
+			absent = absent[1:]
+		}
+		if len(absent) > 0 && absent[0][0] < end {
+			continue
+		}
+
+		if bytes.Equal(hashes[i*HashSize:(i+1)*HashSize], info.Pieces[i*HashSize:(i+1)*HashSize]) {
+			res.Pieces.Set(i)
+		}
+	}
+	return res, nil
+}
+
+// fileSize returns the size of the regular file at path,
+// ok is false when there is no file or it's a directory or another special file.
+func fileSize(path string) (size int64, ok bool, err error) {
+	fi, err := os.Stat(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, syscall.ENOTDIR):
+		return 0, false, nil // ENOTDIR: a directory on the path is a file
+	case err != nil:
+		return 0, false, err
+	case !fi.Mode().IsRegular():
+		return 0, false, nil
+	}
+	return fi.Size(), true, nil
+}
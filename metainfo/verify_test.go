@@ -0,0 +1,212 @@
+package metainfo
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func buildInfo(t *testing.T, b *Builder, path string) *Info {
+	t.Helper()
+
+	mi, err := b.Build(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &info
+}
+
+func TestVerify(t *testing.T) {
+	base := t.TempDir()
+	dir := filepath.Join(base, "data")
+	a := bytes.Repeat([]byte("a"), 40000)
+	b := bytes.Repeat([]byte("b"), 10000)
+	c := bytes.Repeat([]byte("c"), 30000)
+	for name, content := range map[string][]byte{"a": a, "sub/b": b, "sub/c": c} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// pieces: [0, 16384) [16384, 32768) [32768, 49152) [49152, 65536) [65536, 80000)
+	// files:  a [0, 40000) sub/b [40000, 50000) sub/c [50000, 80000)
+	info := buildInfo(t, &Builder{PieceLength: minPieceLength}, dir)
+	verify := func() *VerifyResult {
+		t.Helper()
+		v := &Verifier{Workers: 2}
+		res, err := v.Verify(context.Background(), info, base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	validPieces := func(res *VerifyResult) []int {
+		var valid []int
+		for i := 0; i < res.NumPieces; i++ {
+			if res.Pieces.Has(i) {
+				valid = append(valid, i)
+			}
+		}
+		return valid
+	}
+
+	res := verify()
+	if !res.Complete() || res.NumPieces != 5 || res.Missing != nil || res.Short != nil {
+		t.Fatalf("got %+v", res)
+	}
+
+	// corrupted byte in sub/b, which is in piece 2
+	b[100] = 'x'
+	if err := os.WriteFile(filepath.Join(dir, "sub", "b"), b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	res = verify()
+	if got := validPieces(res); !reflect.DeepEqual(got, []int{0, 1, 3, 4}) {
+		t.Fatalf("got valid pieces %v", got)
+	}
+
+	// sub/c is truncated to [50000, 60000), pieces 3 and 4 are gone
+	if err := os.WriteFile(filepath.Join(dir, "sub", "c"), c[:10000], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	res = verify()
+	if got := validPieces(res); !reflect.DeepEqual(got, []int{0, 1}) {
+		t.Fatalf("got valid pieces %v", got)
+	}
+	if want := []string{filepath.Join(dir, "sub", "c")}; !reflect.DeepEqual(res.Short, want) {
+		t.Fatalf("got short %v", res.Short)
+	}
+
+	// a is missing, pieces 0, 1 and 2 are gone
+	if err := os.Remove(filepath.Join(dir, "a")); err != nil {
+		t.Fatal(err)
+	}
+	res = verify()
+	if got := validPieces(res); got != nil {
+		t.Fatalf("got valid pieces %v", got)
+	}
+	if want := []string{filepath.Join(dir, "a")}; !reflect.DeepEqual(res.Missing, want) {
+		t.Fatalf("got missing %v", res.Missing)
+	}
+	if res.Complete() {
+		t.Fatal("want incomplete")
+	}
+
+	// a is a directory and sub is a file, everything is missing
+	if err := os.Mkdir(filepath.Join(dir, "a"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(filepath.Join(dir, "sub")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sub"), b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	res = verify()
+	if got := validPieces(res); got != nil {
+		t.Fatalf("got valid pieces %v", got)
+	}
+	want := []string{filepath.Join(dir, "a"), filepath.Join(dir, "sub", "b"), filepath.Join(dir, "sub", "c")}
+	if !reflect.DeepEqual(res.Missing, want) || res.Short != nil {
+		t.Fatalf("got missing %v short %v", res.Missing, res.Short)
+	}
+}
+
+func TestVerifyPadFiles(t *testing.T) {
+	base := t.TempDir()
+	dir := writeFiles(t, map[string]string{
+		"a": string(bytes.Repeat([]byte("a"), 20000)),
+		"b": "bbb",
+	})
+
+	info := buildInfo(t, &Builder{PieceLength: minPieceLength, PadFiles: true, Name: "data"}, dir)
+	if err := os.Rename(dir, filepath.Join(base, "data")); err != nil {
+		t.Fatal(err)
+	}
+
+	var v Verifier
+	res, err := v.Verify(context.Background(), info, base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Complete() || res.NumPieces != 3 {
+		t.Fatalf("got %+v", res)
+	}
+}
+
+func TestVerifySingleFile(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"file.iso": "hello"})
+	info := buildInfo(t, &Builder{}, filepath.Join(dir, "file.iso"))
+
+	var v Verifier
+	res, err := v.Verify(context.Background(), info, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Complete() {
+		t.Fatalf("got %+v", res)
+	}
+
+	res, err = v.Verify(context.Background(), info, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Complete() || len(res.Missing) != 1 {
+		t.Fatalf("got %+v", res)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := v.Verify(ctx, info, dir); err == nil {
+		t.Fatal("want error")
+	}
+	if _, err := v.Verify(context.Background(), &Info{MetaVersion: 2}, dir); err == nil {
+		t.Fatal("want error")
+	}
+}
+
+func TestBitfield(t *testing.T) {
+	bf := NewBitfield(10)
+	if len(bf) != 2 {
+		t.Fatalf("got %d bytes", len(bf))
+	}
+	bf.Set(0)
+	bf.Set(9)
+	if !bf.Has(0) || bf.Has(1) || !bf.Has(9) || bf.Count() != 2 {
+		t.Fatalf("got %08b", bf)
+	}
+	if bf[0] != 0x80 || bf[1] != 0x40 {
+		t.Fatalf("got %08b", bf)
+	}
+}
+
+func TestVerifyPathTraversal(t *testing.T) {
+	base := writeFiles(t, map[string]string{"secret": "hello", "dl/data/a": "hello"})
+	dl := filepath.Join(base, "dl")
+	info := buildInfo(t, &Builder{}, filepath.Join(base, "secret"))
+
+	var v Verifier
+	tcs := []*Info{
+		{Name: "..", PieceLength: info.PieceLength, Pieces: info.Pieces, Length: 5},
+		{Name: "../secret", PieceLength: info.PieceLength, Pieces: info.Pieces, Length: 5},
+		{Name: "data", PieceLength: info.PieceLength, Pieces: info.Pieces, Files: []File{{Length: 5, Path: []string{"..", "..", "secret"}}}},
+		{Name: "data", PieceLength: info.PieceLength, Pieces: info.Pieces, Files: []File{{Length: 5, Path: []string{base, "secret"}}}},
+		{Name: "data", PieceLength: info.PieceLength, Pieces: info.Pieces, Files: []File{{Length: 5, Path: []string{""}}}},
+	}
+	for i, info := range tcs {
+		if res, err := v.Verify(context.Background(), info, dl); err == nil {
+			t.Fatalf("[test %d] want error, got %+v", i+1, res)
+		}
+	}
+}
@@ -20,3 +20,20 @@ func getStrArray() *[strSliceLen]string {
 func putStrArray(ss *[strSliceLen]string) {
 	strslicePool.Put(ss)
 }
+
+const intSliceLen = 20
+
+var intslicePool = sync.Pool{
+	New: func() any {
+		var j [intSliceLen]int
+		return &j
+	},
+}
+
+func getIntArray() *[intSliceLen]int {
+	return intslicePool.Get().(*[intSliceLen]int)
+}
+
+func putIntArray(ss *[intSliceLen]int) {
+	intslicePool.Put(ss)
+}
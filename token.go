@@ -0,0 +1,223 @@
+package bencode
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// TokenKind is a kind of a Bencode token.
+type TokenKind int
+
+// Kinds of Bencode tokens.
+const (
+	DictStart TokenKind = iota + 1 // start of a dictionary, 'd'
+	ListStart                      // start of a list, 'l'
+	End                            // end of a dictionary or a list, 'e'
+	Int                            // integer, value is in Token.Int and Token.Bytes
+	String                         // string, value is in Token.Bytes
+)
+
+func (k TokenKind) String() string {
+	switch k {
+	case DictStart:
+		return "DictStart"
+	case ListStart:
+		return "ListStart"
+	case End:
+		return "End"
+	case Int:
+		return "Int"
+	case String:
+		return "String"
+	default:
+		return fmt.Sprintf("TokenKind(%d)", int(k))
+	}
+}
+
+// Token is a single Bencode token returned by Decoder.Token.
+//
+// Integers of any size are allowed, Bytes holds their decimal digits
+// (use math/big or strconv.ParseUint for values out of the int64 range),
+// Int is set only when the value fits into int64.
+type Token struct {
+	Kind  TokenKind
+	Int   int64  // value of Int token if it fits into int64
+	Bytes []byte // value of String token or digits of Int token, points into the decoder buffer
+}
+
+// tokenLevel describes an open list or dictionary in the token stream.
+type tokenLevel struct {
+	kind    TokenKind // DictStart or ListStart
+	count   int       // number of elements read so far
+	lastKey []byte    // last dictionary key
+}
+
+// Token returns the next Bencode token in the input stream.
+// At the end of the input stream, Token returns io.EOF.
+//
+// Dictionary keys are returned as String tokens
+// followed by the tokens of the corresponding value.
+func (d *Decoder) Token() (Token, error) {
+	if err := d.checkInputSize(); err != nil {
+		return Token{}, fmt.Errorf("bencode: token failed: %w", err)
+	}
+	d.start = d.cursor
+
+	c, err := d.peek()
+	if err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) && len(d.tokens) == 0 {
+			return Token{}, io.EOF
+		}
+		return Token{}, fmt.Errorf("bencode: token failed: %w", err)
+	}
+
+	if c == 'e' {
+		if len(d.tokens) == 0 {
+			err := &SyntaxError{Offset: d.InputOffset(), Msg: "unexpected end of list or dictionary", err: ErrInvalidList}
+			return Token{}, fmt.Errorf("bencode: token failed: %w", err)
+		}
+		if top := d.tokens[len(d.tokens)-1]; top.kind == DictStart && top.count%2 == 1 {
+			err := &SyntaxError{Offset: d.InputOffset(), Msg: "missing dictionary value", err: ErrInvalidDict}
+			return Token{}, fmt.Errorf("bencode: token failed: %w", err)
+		}
+		d.cursor++
+		d.tokens = d.tokens[:len(d.tokens)-1]
+		d.tokenDone()
+		return Token{Kind: End}, nil
+	}
+
+	if err := d.checkTokenElements(); err != nil {
+		return Token{}, fmt.Errorf("bencode: token failed: %w", err)
+	}
+
+	if d.expectKey() {
+		top := &d.tokens[len(d.tokens)-1]
+		key, err := d.unmarshalKey(top.lastKey)
+		if err != nil {
+			return Token{}, fmt.Errorf("bencode: token failed: %w", err)
+		}
+		top.lastKey = key
+		top.count++
+		return Token{Kind: String, Bytes: key}, nil
+	}
+
+	switch c {
+	case 'd':
+		d.depth = len(d.tokens)
+		if err := d.enter(); err != nil {
+			return Token{}, fmt.Errorf("bencode: token failed: %w", err)
+		}
+		d.tokens = append(d.tokens, tokenLevel{kind: DictStart})
+		return Token{Kind: DictStart}, nil
+
+	case 'l':
+		d.depth = len(d.tokens)
+		if err := d.enter(); err != nil {
+			return Token{}, fmt.Errorf("bencode: token failed: %w", err)
+		}
+		d.tokens = append(d.tokens, tokenLevel{kind: ListStart})
+		return Token{Kind: ListStart}, nil
+
+	case 'i':
+		digits, err := d.readInt()
+		if err != nil {
+			return Token{}, fmt.Errorf("bencode: token failed: %w", err)
+		}
+		n, err := strconv.ParseInt(b2s(digits), 10, 64)
+		if err != nil {
+			n = 0 // out of int64 range, only digits are set
+		}
+		d.tokenDone()
+		return Token{Kind: Int, Int: n, Bytes: digits}, nil
+
+	default:
+		b, err := d.unmarshalString()
+		if err != nil {
+			return Token{}, fmt.Errorf("bencode: token failed: %w", err)
+		}
+		d.tokenDone()
+		return Token{Kind: String, Bytes: b}, nil
+	}
+}
+
+// More reports whether there is another element
+// in the current list or dictionary being parsed.
+// At the top level it reports whether there is more input.
+func (d *Decoder) More() bool {
+	c, err := d.peek()
+	return err == nil && c != 'e'
+}
+
+// Skip skips the next value in the input stream without allocations.
+// If the next token starts a list or a dictionary,
+// everything up to and including its end is skipped.
+//
+// Skip doesn't skip the end of a list or dictionary, it returns
+// a SyntaxError instead. Use More to check for it and Token to read it.
+func (d *Decoder) Skip() error {
+	if err := d.checkInputSize(); err != nil {
+		return fmt.Errorf("bencode: skip failed: %w", err)
+	}
+	d.start = d.cursor
+
+	c, err := d.peek()
+	if err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) && len(d.tokens) == 0 {
+			return io.EOF
+		}
+		return fmt.Errorf("bencode: skip failed: %w", err)
+	}
+	if c == 'e' {
+		err := &SyntaxError{Offset: d.InputOffset(), Msg: "cannot skip end of list or dictionary", err: ErrInvalidList}
+		return fmt.Errorf("bencode: skip failed: %w", err)
+	}
+	if err := d.checkTokenElements(); err != nil {
+		return fmt.Errorf("bencode: skip failed: %w", err)
+	}
+	d.depth = len(d.tokens)
+	if err := d.skip(); err != nil {
+		return fmt.Errorf("bencode: skip failed: %w", err)
+	}
+	d.tokenDone()
+	return nil
+}
+
+// checkTokenElements checks the elements limit before reading
+// a new element of the current list or dictionary.
+func (d *Decoder) checkTokenElements() error {
+	limit := d.limits.MaxElements
+	if limit <= 0 || len(d.tokens) == 0 {
+		return nil
+	}
+
+	top := d.tokens[len(d.tokens)-1]
+	n := top.count
+	if top.kind == DictStart {
+		if top.count%2 == 1 {
+			return nil // value of the current element
+		}
+		n /= 2
+	}
+	if n >= limit {
+		return &LimitExceededError{Limit: "elements", Max: int64(limit), Offset: d.InputOffset()}
+	}
+	return nil
+}
+
+// expectKey reports whether the next token must be a dictionary key.
+func (d *Decoder) expectKey() bool {
+	if len(d.tokens) == 0 {
+		return false
+	}
+	top := d.tokens[len(d.tokens)-1]
+	return top.kind == DictStart && top.count%2 == 0
+}
+
+// tokenDone marks an element of the current list or dictionary as read.
+func (d *Decoder) tokenDone() {
+	if len(d.tokens) > 0 {
+		d.tokens[len(d.tokens)-1].count++
+	}
+}
@@ -0,0 +1,209 @@
+package bencode
+
+import (
+	"errors"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestDecoderToken(t *testing.T) {
+	input := `d4:infod6:lengthi42e4:name3:fooe4:listli1el3:bareee` + `i7e`
+
+	want := []Token{
+		{Kind: DictStart},
+		{Kind: String, Bytes: []byte("info")},
+		{Kind: DictStart},
+		{Kind: String, Bytes: []byte("length")},
+		{Kind: Int, Int: 42, Bytes: []byte("42")},
+		{Kind: String, Bytes: []byte("name")},
+		{Kind: String, Bytes: []byte("foo")},
+		{Kind: End},
+		{Kind: String, Bytes: []byte("list")},
+		{Kind: ListStart},
+		{Kind: Int, Int: 1, Bytes: []byte("1")},
+		{Kind: ListStart},
+		{Kind: String, Bytes: []byte("bar")},
+		{Kind: End},
+		{Kind: End},
+		{Kind: End},
+		{Kind: Int, Int: 7, Bytes: []byte("7")},
+	}
+
+	decoders := map[string]*Decoder{
+		"bytes":   NewDecodeBytes([]byte(input)),
+		"onebyte": NewDecoder(iotest.OneByteReader(strings.NewReader(input))),
+	}
+
+	for name, d := range decoders {
+		var got []Token
+		for {
+			tok, err := d.Token()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			got = append(got, tok)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: got %v want: %v", name, got, want)
+		}
+	}
+}
+
+func TestDecoderTokenBigInt(t *testing.T) {
+	d := NewDecodeBytes([]byte(`li18446744073709551615ei-123456789012345678901234567890ei-9223372036854775808ee`))
+
+	mustToken(t, d, ListStart)
+	tok := mustToken(t, d, Int)
+	if n, err := strconv.ParseUint(string(tok.Bytes), 10, 64); err != nil || n != math.MaxUint64 || tok.Int != 0 {
+		t.Fatalf("got %+v", tok)
+	}
+	tok = mustToken(t, d, Int)
+	if want := "-123456789012345678901234567890"; string(tok.Bytes) != want || tok.Int != 0 {
+		t.Fatalf("got %+v want: %v", tok, want)
+	}
+	tok = mustToken(t, d, Int)
+	if tok.Int != math.MinInt64 {
+		t.Fatalf("got %+v want: %v", tok, int64(math.MinInt64))
+	}
+	mustToken(t, d, End)
+}
+
+func TestDecoderTokenMoreSkip(t *testing.T) {
+	d := NewDecodeBytes([]byte(`d5:filesld6:lengthi1eed6:lengthi2eee4:name3:fooe`))
+
+	mustToken(t, d, DictStart)
+	var keys []string
+	for d.More() {
+		key := mustToken(t, d, String)
+		keys = append(keys, string(key.Bytes))
+		if err := d.Skip(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mustToken(t, d, End)
+
+	if want := []string{"files", "name"}; !reflect.DeepEqual(keys, want) {
+		t.Fatalf("got %v want: %v", keys, want)
+	}
+	if d.More() {
+		t.Fatal("want no more input")
+	}
+	if err := d.Skip(); err != io.EOF {
+		t.Fatalf("want io.EOF, got %v", err)
+	}
+}
+
+func TestDecoderSkipErrors(t *testing.T) {
+	d := NewDecodeBytes([]byte(`li1ee`))
+	mustToken(t, d, ListStart)
+	mustToken(t, d, Int)
+	err := d.Skip()
+	if !errors.Is(err, ErrInvalidList) || !strings.HasPrefix(err.Error(), "bencode: skip failed: ") {
+		t.Fatalf("want end of list error, got %v", err)
+	}
+	mustToken(t, d, End)
+
+	d = NewDecodeBytes([]byte(`e`))
+	if err := d.Skip(); !errors.Is(err, ErrInvalidList) {
+		t.Fatalf("want end of list error, got %v", err)
+	}
+
+	d = NewDecodeBytes([]byte(`l4:spame`))
+	d.SetLimits(Limits{MaxInputSize: 2})
+	err = d.Skip()
+	var limitErr *LimitExceededError
+	if !errors.As(err, &limitErr) || !strings.HasPrefix(err.Error(), "bencode: skip failed: ") {
+		t.Fatalf("want wrapped limit error, got %v", err)
+	}
+}
+
+func TestDecoderTokenDecode(t *testing.T) {
+	d := NewDecodeBytes([]byte(`ld1:ai1eed1:ai2eee`))
+
+	mustToken(t, d, ListStart)
+	var sum int
+	for d.More() {
+		var v struct {
+			A int `bencode:"a"`
+		}
+		if err := d.Decode(&v); err != nil {
+			t.Fatal(err)
+		}
+		sum += v.A
+	}
+	mustToken(t, d, End)
+
+	if sum != 3 {
+		t.Fatalf("got %d", sum)
+	}
+}
+
+func TestDecoderTokenErrors(t *testing.T) {
+	tcs := []string{
+		`e`,
+		`di1ei2ee`,
+		`d1:ae`,
+		`l`,
+		`i1x`,
+		`5:abc`,
+	}
+	for i, input := range tcs {
+		d := NewDecodeBytes([]byte(input))
+		var err error
+		for err == nil {
+			_, err = d.Token()
+		}
+		if err == io.EOF {
+			t.Fatalf("[test %d] want error for %q", i+1, input)
+		}
+		if !strings.HasPrefix(err.Error(), "bencode: token failed: ") {
+			t.Fatalf("[test %d] want wrapped error, got %v", i+1, err)
+		}
+	}
+
+	for _, limits := range []Limits{{MaxDepth: 1}, {MaxElements: 1}, {MaxInputSize: 3}} {
+		d := NewDecodeBytes([]byte(`lli1ei2eee`))
+		d.SetLimits(limits)
+		var err error
+		for err == nil {
+			_, err = d.Token()
+		}
+		var limitErr *LimitExceededError
+		if !errors.As(err, &limitErr) || !strings.HasPrefix(err.Error(), "bencode: token failed: ") {
+			t.Fatalf("want wrapped LimitExceededError for %+v, got %v", limits, err)
+		}
+	}
+}
+
+func TestDecoderSkipAllocs(t *testing.T) {
+	d := NewDecodeBytes(unmarshalBenchData)
+	allocs := testing.AllocsPerRun(10, func() {
+		d.cursor = 0
+		if err := d.Skip(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("got %v allocs", allocs)
+	}
+}
+
+func mustToken(t *testing.T, d *Decoder, kind TokenKind) Token {
+	t.Helper()
+	tok, err := d.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.Kind != kind {
+		t.Fatalf("got %v want: %v", tok.Kind, kind)
+	}
+	return tok
+}
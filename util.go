@@ -3,7 +3,9 @@ package bencode
 import (
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"unicode"
 )
 
@@ -29,29 +31,215 @@ func sortStrings(ss []string) {
 	}
 }
 
-func fieldTag(field reflect.StructField, v reflect.Value) (string, bool) {
+// sortDict sorts order, which is a list of indices in dict, by the keys of dict.
+// Insertion sort is used for small dicts to avoid allocations.
+func sortDict(dict D, order []int) {
+	if len(order) <= intSliceLen {
+		for i := 1; i < len(order); i++ {
+			for j := i; j > 0; j-- {
+				if dict[order[j]].K >= dict[order[j-1]].K {
+					break
+				}
+				order[j], order[j-1] = order[j-1], order[j]
+			}
+		}
+	} else {
+		sort.Slice(order, func(i, j int) bool {
+			return dict[order[i]].K < dict[order[j]].K
+		})
+	}
+}
+
+// parseTag returns the dictionary key of the field and its options,
+// tagged reports whether the key is set in the tag.
+// The key is empty for embedded structs without a name in the tag,
+// their fields are promoted into the parent dictionary.
+func parseTag(field reflect.StructField) (name string, tagged, omitEmpty, ok bool) {
 	tag := field.Tag.Get("bencode")
+	if tag == "-" {
+		return "", false, false, false
+	}
 
 	var opts string
-	switch {
-	case tag == "":
-		return field.Name, true
-	case tag == "-":
-		return "", false
-	default:
-		if idx := strings.Index(tag, ","); idx != -1 {
-			tag, opts = tag[:idx], tag[idx:]
-		}
+	if idx := strings.Index(tag, ","); idx != -1 {
+		tag, opts = tag[:idx], tag[idx:]
 	}
+	omitEmpty = strings.Contains(opts, ",omitempty")
 
 	switch {
-	case strings.Contains(opts, ",omitempty") && isZero(v):
-		return "", false
+	case tag == "" && field.Anonymous && isStructOrPtr(field.Type):
+		return "", false, omitEmpty, true
 	case !isValidTag(tag):
-		return field.Name, true
+		return field.Name, false, omitEmpty, true
 	default:
-		return tag, true
+		return tag, true, omitEmpty, true
+	}
+}
+
+// structField describes a struct field visible as a dictionary key.
+type structField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+	tagged    bool
+	key       []byte      // pre-encoded name, like 8:interval
+	encode    encoderFunc // encoder for the field type
+}
+
+// structFields is a set of fields of a struct type sorted by name,
+// embedded structs are flattened.
+type structFields struct {
+	list   []structField
+	byName map[string]int
+}
+
+var fieldCache sync.Map // map[reflect.Type]*structFields
+
+func cachedFields(t reflect.Type) *structFields {
+	if f, ok := fieldCache.Load(t); ok {
+		return f.(*structFields)
+	}
+	f, _ := fieldCache.LoadOrStore(t, typeFields(t))
+	return f.(*structFields)
+}
+
+func typeFields(t reflect.Type) *structFields {
+	var all []structField
+	walkFields(&all, t, nil, make(map[reflect.Type]bool))
+
+	// fields with the same name are next to each other, the shallowest go first,
+	// then tagged ones. sorting is stable to keep the order of declaration.
+	sort.SliceStable(all, func(i, j int) bool {
+		a, b := all[i], all[j]
+		switch {
+		case a.name != b.name:
+			return a.name < b.name
+		case len(a.index) != len(b.index):
+			return len(a.index) < len(b.index)
+		default:
+			return a.tagged && !b.tagged
+		}
+	})
+
+	fields := &structFields{
+		byName: make(map[string]int),
+	}
+	for i := 0; i < len(all); {
+		j := i + 1
+		for j < len(all) && all[j].name == all[i].name {
+			j++
+		}
+		if f, ok := dominantField(all[i:j]); ok {
+			fields.list = append(fields.list, f)
+		}
+		i = j
+	}
+
+	for i := range fields.list {
+		f := &fields.list[i]
+		fields.byName[f.name] = i
+		f.key = strconv.AppendInt(nil, int64(len(f.name)), 10)
+		f.key = append(f.key, ':')
+		f.key = append(f.key, f.name...)
+	}
+	return fields
+}
+
+// dominantField returns the field which wins among fields with the same name,
+// like in encoding/json: the shallowest one, a tagged one at the same depth.
+// Fields are sorted by depth and tag, if there is still a tie, the name is dropped.
+func dominantField(fields []structField) (structField, bool) {
+	if len(fields) > 1 &&
+		len(fields[0].index) == len(fields[1].index) &&
+		fields[0].tagged == fields[1].tagged {
+		return structField{}, false
+	}
+	return fields[0], true
+}
+
+// walkFields collects fields of t, embedded structs and pointers to structs
+// are walked recursively. visited holds types on the current path to stop cycles.
+func walkFields(fields *[]structField, t reflect.Type, index []int, visited map[reflect.Type]bool) {
+	visited[t] = true
+	defer delete(visited, t)
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue // unexported
+		}
+
+		name, tagged, omitEmpty, ok := parseTag(field)
+		if !ok {
+			continue
+		}
+
+		fieldIndex := make([]int, len(index)+1)
+		copy(fieldIndex, index)
+		fieldIndex[len(index)] = i
+
+		if name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if !visited[ft] {
+				walkFields(fields, ft, fieldIndex, visited)
+			}
+			continue
+		}
+		if field.PkgPath != "" {
+			continue // unexported embedded non-struct or with a name in the tag
+		}
+
+		*fields = append(*fields, structField{
+			name:      name,
+			index:     fieldIndex,
+			omitEmpty: omitEmpty,
+			tagged:    tagged,
+			encode:    fieldEncoder(field.Type),
+		})
+	}
+}
+
+func isStructOrPtr(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
+// fieldByIndex returns the nested field of v,
+// ok is false when an embedded pointer on the way is nil.
+func fieldByIndex(v reflect.Value, index []int) (_ reflect.Value, ok bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// fieldByIndexAlloc is like fieldByIndex but allocates nil embedded pointers,
+// ok is false when a pointer cannot be set because it's unexported.
+func fieldByIndexAlloc(v reflect.Value, index []int) (_ reflect.Value, ok bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
 	}
+	return v, true
 }
 
 func isValidTag(key string) bool {